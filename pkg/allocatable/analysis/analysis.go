@@ -0,0 +1,348 @@
+package analysis
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"k8s.io/api/core/v1"
+
+	"github.com/dashpole/allocatable/pkg/allocatable/types"
+	"github.com/dashpole/allocatable/pkg/common"
+)
+
+// Options configure the allocatable analysis.
+type Options struct {
+	// Output is the path of the CSV of affected clusters.
+	Output string
+	// PoliciesFile is a YAML or JSON file of reservation policies to
+	// compare.  If empty, the default policy is used.
+	PoliciesFile string
+	// NodeReport, if set, is the path to write the per-node stats of
+	// affected clusters to, in NodeReportFormat, either csv or json.
+	NodeReport       string
+	NodeReportFormat string
+	// Summary, if set, is the path, without extension, to write the fleet
+	// summary to as CSV and JSON.  The summary is grouped by the identifier
+	// field SummaryGroupBy, if set.
+	Summary        string
+	SummaryGroupBy string
+	// Filter selects the clusters to analyze.
+	Filter common.ClusterFilter
+	// Parallelism is the number of clusters analyzed at once, or one per CPU
+	// if it is less than one.
+	Parallelism int
+	// Diagnostics, if set, is the path to write the problems found in the
+	// input to, as JSON.
+	Diagnostics string
+	// StatusReport, if set, is the path to write the status of every
+	// cluster's scrape to, as CSV.
+	StatusReport string
+}
+
+func (o Options) validate() error {
+	if o.NodeReportFormat != "csv" && o.NodeReportFormat != "json" {
+		return fmt.Errorf("Invalid node report format %s, must be csv or json", o.NodeReportFormat)
+	}
+	switch o.SummaryGroupBy {
+	case "", common.ProjectField, common.LocationField, common.MasterVersionField:
+	default:
+		return fmt.Errorf("Invalid summary grouping %s, must be %s, %s or %s", o.SummaryGroupBy, common.ProjectField, common.LocationField, common.MasterVersionField)
+	}
+	return nil
+}
+
+// clusterResult holds the stats for a cluster, with one entry per policy.
+type clusterResult struct {
+	identifier common.ClusterIdentifier
+	location   string
+	status     string
+	failures   []common.Failure
+	// nodes is only kept until the cluster is added to the summary
+	nodes     types.ClusterAllocated
+	stats     []types.ClusterStats
+	nodeStats [][]types.NodeStats
+}
+
+// getProblems returns the problems found in the output of the cluster.
+func (c clusterResult) getProblems() []common.Problem {
+	problems := []common.Problem{}
+	for _, failure := range c.failures {
+		problems = append(problems, common.Problem{
+			Kind:     common.ScrapeErrorProblem,
+			Location: c.location,
+			Cluster:  c.identifier.Raw,
+			Message:  failure.String(),
+		})
+	}
+	if c.status == common.NoNodesStatus {
+		problems = append(problems, common.Problem{
+			Kind:     common.NoNodesProblem,
+			Location: c.location,
+			Cluster:  c.identifier.Raw,
+			Message:  "No nodes found in the output",
+		})
+	}
+	return problems
+}
+
+// getStatusRow returns the row of the cluster in the status report.
+func (c clusterResult) getStatusRow() []string {
+	lastError := ""
+	if len(c.failures) > 0 {
+		lastError = c.failures[len(c.failures)-1].String()
+	}
+	row := c.identifier.ToSlice()
+	return append(row, c.location, c.status, strconv.Itoa(len(c.nodes)), strconv.Itoa(len(c.failures)), lastError)
+}
+
+func getStatusHeader() []string {
+	header := common.GetClusterIdentifierHeader()
+	return append(header, "Location", "Status", "Nodes", "Failures", "Last Error")
+}
+
+// getClusterStatus returns the status of a cluster's scrape, given its
+// output, the number of nodes found in it, and its failures.  A scrape
+// without nodes is no-nodes, rather than failed, if the scraper found no
+// nodes, or did not fail.
+func getClusterStatus(lines []string, nodes int, failures []common.Failure) string {
+	if nodes == 0 && (types.HasNoNodesFound(lines) || len(failures) == 0) {
+		return common.NoNodesStatus
+	}
+	return common.GetStatus(nodes > 0, failures)
+}
+
+// isAffected returns true if the cluster is affected by any of the policies.
+func (c clusterResult) isAffected() bool {
+	for _, cluster := range c.stats {
+		if cluster.IsAffected() {
+			return true
+		}
+	}
+	return false
+}
+
+// Run analyzes the clusters read from source, and writes the results.
+// Clusters which can not be parsed are skipped, and recorded in the returned
+// diagnostics.  It returns an error if the input can not be read, or the
+// results can not be written.
+func Run(source common.Source, opts Options) (*common.Diagnostics, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	policies, err := loadReservationPolicies(opts.PoliciesFile)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading reservation policies: %v", err)
+	}
+
+	// only affected clusters are kept, as they are the only ones written
+	results := []clusterResult{}
+	summary := newFleetSummary(policies, opts.SummaryGroupBy)
+	diagnostics := common.NewDiagnostics()
+	statusRows := [][]string{getStatusHeader()}
+	process := func(output common.ClusterOutput) (interface{}, error) {
+		if !opts.Filter.Matches(output.Identifier) {
+			return nil, nil
+		}
+		clusterAllocated, err := types.GetClusterAllocated(output)
+		if err != nil {
+			return nil, err
+		}
+		result := &clusterResult{
+			identifier: output.Identifier,
+			location:   output.Location,
+			failures:   common.GetFailures(output.Lines),
+			nodes:      clusterAllocated,
+		}
+		result.status = getClusterStatus(output.Lines, len(clusterAllocated), result.failures)
+		if len(clusterAllocated) == 0 {
+			return result, nil
+		}
+		for _, policy := range policies {
+			stats, nodeStats := getClusterStats(clusterAllocated, output.Identifier, policy)
+			stats.Status = result.status
+			result.stats = append(result.stats, stats)
+			result.nodeStats = append(result.nodeStats, nodeStats)
+		}
+		return result, nil
+	}
+	handle := func(value interface{}) {
+		result, ok := value.(*clusterResult)
+		if !ok {
+			return
+		}
+		diagnostics.AddCluster(result.status, result.getProblems()...)
+		statusRows = append(statusRows, result.getStatusRow())
+		if len(result.nodes) == 0 {
+			return
+		}
+		summary.add(result)
+		result.nodes = nil
+		if !result.isAffected() {
+			return
+		}
+		if opts.NodeReport == "" {
+			result.nodeStats = nil
+		}
+		results = append(results, *result)
+	}
+	skip := func(location string, err error) {
+		fmt.Fprintf(os.Stderr, "Skipping %s: %v\n", location, err)
+		diagnostics.AddCluster(common.FailedStatus, common.Problem{
+			Kind:     common.UnparseableProblem,
+			Location: location,
+			Message:  err.Error(),
+		})
+		statusRows = append(statusRows, clusterResult{
+			location: location,
+			status:   common.FailedStatus,
+			failures: []common.Failure{{Error: err.Error()}},
+		}.getStatusRow())
+	}
+	err = common.ReadParallel(source, opts.Parallelism, process, handle, skip)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading input: %v", err)
+	}
+
+	allStats := []types.ClusterStats{}
+	for _, result := range results {
+		allStats = append(allStats, result.stats...)
+	}
+	resources := types.GetResourceNames(allStats)
+	data := [][]string{types.GetClusterStatsHeader(resources)}
+	for _, result := range results {
+		// include every policy for a cluster affected by any of them, so the
+		// policies can be compared side by side
+		for _, cluster := range result.stats {
+			data = append(data, cluster.ToSlice(resources))
+		}
+	}
+	if err := common.ToCSV(opts.Output, data); err != nil {
+		return diagnostics, fmt.Errorf("Error writing output to csv: %v", err)
+	}
+
+	if opts.NodeReport != "" {
+		if err := writeNodeReport(opts.NodeReport, opts.NodeReportFormat, results, resources); err != nil {
+			return diagnostics, fmt.Errorf("Error writing node report: %v", err)
+		}
+	}
+
+	if opts.Summary != "" {
+		summary.finish()
+		if err := summary.writeSummary(opts.Summary); err != nil {
+			return diagnostics, fmt.Errorf("Error writing summary: %v", err)
+		}
+	}
+
+	if opts.StatusReport != "" {
+		if err := common.ToCSV(opts.StatusReport, statusRows); err != nil {
+			return diagnostics, fmt.Errorf("Error writing status report: %v", err)
+		}
+	}
+
+	if opts.Diagnostics != "" {
+		if err := diagnostics.Write(opts.Diagnostics); err != nil {
+			return diagnostics, fmt.Errorf("Error writing diagnostics: %v", err)
+		}
+	}
+	return diagnostics, nil
+}
+
+func writeNodeReport(filename, format string, results []clusterResult, resources []v1.ResourceName) error {
+	allNodeStats := []types.NodeStats{}
+	for _, result := range results {
+		for _, nodeStats := range result.nodeStats {
+			allNodeStats = append(allNodeStats, nodeStats...)
+		}
+	}
+	if format == "json" {
+		return common.ToJSON(filename, allNodeStats)
+	}
+	data := [][]string{types.GetNodeStatsHeader(resources)}
+	for _, nodeStats := range allNodeStats {
+		data = append(data, nodeStats.ToSlice(resources))
+	}
+	return common.ToCSV(filename, data)
+}
+
+func getNodeStats(na *types.NodeAllocated, id common.ClusterIdentifier, policy reservationPolicy) types.NodeStats {
+	stats := types.NodeStats{
+		Identifier: id,
+		Policy:     policy.Name,
+		NodeName:   na.NodeName,
+		Resources:  map[v1.ResourceName]types.NodeResourceStats{},
+		Fits:       true,
+	}
+	for _, name := range na.ResourceNames() {
+		r := types.NodeResourceStats{
+			Capacity:    types.QuantityValue(name, na.Capacity[name]),
+			Allocatable: types.QuantityValue(name, na.Allocatable[name]),
+			Proposed:    policy.proposedAllocatable(name, na),
+			Requests:    types.QuantityValue(name, na.Requests[name]),
+			Limits:      types.QuantityValue(name, na.Limits[name]),
+		}
+		r.Reserved = r.Allocatable - r.Proposed
+		if r.Requests > r.Proposed {
+			r.Overage = r.Requests - r.Proposed
+			stats.Fits = false
+		}
+		stats.Resources[name] = r
+	}
+	return stats
+}
+
+// getClusterStats returns the stats for the cluster, along with the stats for
+// each of its nodes.
+func getClusterStats(c types.ClusterAllocated, id common.ClusterIdentifier, policy reservationPolicy) (types.ClusterStats, []types.NodeStats) {
+	resources := map[v1.ResourceName]types.ResourceStats{}
+	totalRequests := map[v1.ResourceName]int64{}
+	podsByQOSClass := map[v1.PodQOSClass]int{}
+	allNodeStats := []types.NodeStats{}
+	for _, na := range c {
+		for class, count := range na.PodsByQOSClass {
+			podsByQOSClass[class] += count
+		}
+		nodeStats := getNodeStats(&na, id, policy)
+		allNodeStats = append(allNodeStats, nodeStats)
+		for name, n := range nodeStats.Resources {
+			totalRequests[name] += n.Requests
+			r := resources[name]
+			if n.Capacity > 0 {
+				r.Capacity += n.Capacity
+			} else {
+				// legacy scraper output has no capacity
+				r.Capacity += n.Allocatable
+			}
+			r.Allocatable += n.Allocatable
+			r.Reserved += n.Reserved
+			r.Proposed += n.Proposed
+			r.TotalPerNodeOverage += n.Overage
+			r.Limits += n.Limits
+			overcommit := na.GetOvercommitRatio(name)
+			if overcommit > r.MaxNodeOvercommit {
+				r.MaxNodeOvercommit = overcommit
+			}
+			if overcommit > 1 {
+				r.OvercommittedNodes++
+			}
+			resources[name] = r
+		}
+	}
+	for name, r := range resources {
+		if totalRequests[name] > r.Proposed {
+			r.TotalClusterOverage = totalRequests[name] - r.Proposed
+			resources[name] = r
+		}
+	}
+	displaced, unschedulable, simulated := simulateDisplacement(c, allNodeStats)
+	return types.ClusterStats{
+		NumNodes:          len(c),
+		Resources:         resources,
+		PodsByQOSClass:    podsByQOSClass,
+		Simulated:         simulated,
+		DisplacedPods:     displaced,
+		UnschedulablePods: unschedulable,
+		Identifier:        id,
+		Policy:            policy.Name,
+	}, allNodeStats
+}
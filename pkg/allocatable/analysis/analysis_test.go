@@ -0,0 +1,108 @@
+package analysis
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	resourceapi "k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/dashpole/allocatable/pkg/allocatable/types"
+	"github.com/dashpole/allocatable/pkg/common"
+)
+
+// logSource is a foreachmaster log held in memory.
+type logSource []byte
+
+func (s logSource) Read(handle func(common.ClusterOutput), malformed func(location string, err error)) error {
+	return common.ReadForeachMasterLog(bytes.NewReader(s), handle, malformed)
+}
+
+// syntheticLog returns a foreachmaster log of clusters with nodes each, in
+// the scraper's record format.
+func syntheticLog(clusters, nodes int) ([]byte, error) {
+	var log bytes.Buffer
+	for c := 0; c < clusters; c++ {
+		lines := []string{"starting shell script", "Getting Node Allocatable"}
+		for n := 0; n < nodes; n++ {
+			na := types.NodeAllocated{
+				NodeName:    fmt.Sprintf("node-%d-%d", c, n),
+				Capacity:    v1.ResourceList{v1.ResourceCPU: resourceapi.MustParse("2"), v1.ResourceMemory: resourceapi.MustParse("7Gi"), v1.ResourcePods: resourceapi.MustParse("110")},
+				Allocatable: v1.ResourceList{v1.ResourceCPU: resourceapi.MustParse("1930m"), v1.ResourceMemory: resourceapi.MustParse("5632Mi"), v1.ResourcePods: resourceapi.MustParse("110")},
+				Requests:    v1.ResourceList{v1.ResourceCPU: *resourceapi.NewMilliQuantity(int64(500*n), resourceapi.DecimalSI), v1.ResourceMemory: resourceapi.MustParse("1Gi"), v1.ResourcePods: resourceapi.MustParse("12")},
+			}
+			record, err := na.ToRecord()
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, record)
+		}
+		fmt.Fprintf(&log, "{\"project\":\"p%d\",\"zone\":\"us-central1-a\",\"cluster\":\"c%d\"} output: %s\n", c%10, c, strconv.Quote(strings.Join(lines, "\n")+"\n"))
+	}
+	return log.Bytes(), nil
+}
+
+func TestGetClusterStatus(t *testing.T) {
+	failures := []common.Failure{{Stage: "listPods", Error: "unavailable", Attempt: 1}}
+	testCases := []struct {
+		name     string
+		lines    []string
+		nodes    int
+		failures []common.Failure
+		want     string
+	}{
+		{name: "ok", lines: []string{"Getting Node Allocatable"}, nodes: 3, want: common.OKStatus},
+		{name: "partial", lines: []string{"Getting Node Allocatable"}, nodes: 3, failures: failures, want: common.PartialStatus},
+		{name: "failed", lines: []string{"Getting Node Allocatable"}, failures: failures, want: common.FailedStatus},
+		{name: "no nodes found", lines: []string{"Getting Node Allocatable", types.NoNodesFound}, want: common.NoNodesStatus},
+		{name: "no nodes found after a failure", lines: []string{"Getting Node Allocatable", types.NoNodesFound}, failures: failures, want: common.NoNodesStatus},
+		{name: "no nodes without failures", lines: []string{"Getting Node Allocatable"}, want: common.NoNodesStatus},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := getClusterStatus(tc.lines, tc.nodes, tc.failures); got != tc.want {
+				t.Errorf("getClusterStatus() = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+// BenchmarkRun analyzes a synthetic log of 10,000 clusters on one goroutine,
+// and on one per CPU.
+func BenchmarkRun(b *testing.B) {
+	log, err := syntheticLog(10000, 5)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, bc := range []struct {
+		name        string
+		parallelism int
+	}{
+		{name: "sequential", parallelism: 1},
+		{name: "GOMAXPROCS", parallelism: runtime.GOMAXPROCS(0)},
+	} {
+		opts := Options{
+			Output:           filepath.Join(b.TempDir(), "output.csv"),
+			NodeReportFormat: "csv",
+			Summary:          filepath.Join(b.TempDir(), "summary"),
+			Parallelism:      bc.parallelism,
+		}
+		b.Run(bc.name, func(b *testing.B) {
+			b.SetBytes(int64(len(log)))
+			for i := 0; i < b.N; i++ {
+				diagnostics, err := Run(logSource(log), opts)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if diagnostics.Clusters != 10000 {
+					b.Fatalf("got %d clusters, want 10000", diagnostics.Clusters)
+				}
+			}
+		})
+	}
+}
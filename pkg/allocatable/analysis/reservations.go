@@ -0,0 +1,271 @@
+package analysis
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	resourceapi "k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+
+	"github.com/dashpole/allocatable/pkg/allocatable/types"
+)
+
+const (
+	mbPerGB           = 1024
+	millicoresPerCore = 1000
+)
+
+// Baselines a reservation policy can be applied to.
+const (
+	// allocatableBaseline reserves resources on top of what nodes already reserve.
+	allocatableBaseline = "allocatable"
+	// capacityBaseline computes allocatable from node capacity, the way the kubelet does.
+	capacityBaseline = "capacity"
+)
+
+// evictionSignalResources maps the hard eviction signals which the kubelet
+// subtracts from capacity to the resource they apply to.
+var evictionSignalResources = map[string]v1.ResourceName{
+	"memory.available": v1.ResourceMemory,
+	"nodefs.available": v1.ResourceEphemeralStorage,
+}
+
+// reservationPolicy is a named scheme for reserving node resources.  Memory
+// thresholds are in MB, and CPU thresholds are in millicores.
+type reservationPolicy struct {
+	Name string `json:"name"`
+	// Baseline is either allocatableBaseline (the default) or capacityBaseline.
+	Baseline string         `json:"baseline"`
+	Memory   resourcePolicy `json:"memory"`
+	CPU      resourcePolicy `json:"cpu"`
+	// KubeReserved and SystemReserved mirror the kubelet flags of the same
+	// name, e.g. {cpu: 100m, memory: 100Mi, ephemeral-storage: 1Gi}.
+	KubeReserved   v1.ResourceList `json:"kubeReserved"`
+	SystemReserved v1.ResourceList `json:"systemReserved"`
+	// EvictionHard mirrors the kubelet's --eviction-hard flag, and maps an
+	// eviction signal to a quantity or a percentage of the baseline, e.g.
+	// {memory.available: 100Mi, nodefs.available: 10%}.
+	EvictionHard map[string]string `json:"evictionHard"`
+}
+
+type resourcePolicy struct {
+	// MinCapacity is the capacity at or below which nothing is reserved.
+	MinCapacity int64                `json:"minCapacity"`
+	Brackets    []allocatableBracket `json:"brackets"`
+}
+
+type allocatableBracket struct {
+	Threshold            int64   `json:"threshold"`
+	MarginalReservedRate float64 `json:"marginalReservedRate"`
+}
+
+// reservationPolicyFile is the format of the file passed to --policies.
+type reservationPolicyFile struct {
+	Policies []reservationPolicy `json:"policies"`
+}
+
+var defaultReservationPolicy = reservationPolicy{
+	Name: "default",
+	Memory: resourcePolicy{
+		// do not set any memory reserved for nodes with less than 1 Gb of capacity
+		MinCapacity: 1 * mbPerGB,
+		Brackets: []allocatableBracket{
+			{
+				Threshold:            0,
+				MarginalReservedRate: 0.25,
+			},
+			{
+				Threshold:            4 * mbPerGB,
+				MarginalReservedRate: 0.2,
+			},
+			{
+				Threshold:            8 * mbPerGB,
+				MarginalReservedRate: 0.1,
+			},
+			{
+				Threshold:            16 * mbPerGB,
+				MarginalReservedRate: 0.06,
+			},
+			{
+				Threshold:            128 * mbPerGB,
+				MarginalReservedRate: 0.02,
+			},
+		},
+	},
+	CPU: resourcePolicy{
+		Brackets: []allocatableBracket{
+			{
+				Threshold:            0,
+				MarginalReservedRate: 0.06,
+			},
+			{
+				Threshold:            1 * millicoresPerCore,
+				MarginalReservedRate: 0.01,
+			},
+			{
+				Threshold:            2 * millicoresPerCore,
+				MarginalReservedRate: 0.005,
+			},
+			{
+				Threshold:            4 * millicoresPerCore,
+				MarginalReservedRate: 0.0025,
+			},
+		},
+	},
+}
+
+// loadReservationPolicies reads the reservation policies from a YAML or JSON
+// file.  If path is empty, only the default policy is returned.
+func loadReservationPolicies(path string) ([]reservationPolicy, error) {
+	if path == "" {
+		return []reservationPolicy{defaultReservationPolicy}, nil
+	}
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading policies: %v", err)
+	}
+	var policyFile reservationPolicyFile
+	if err := yaml.UnmarshalStrict(blob, &policyFile); err != nil {
+		return nil, fmt.Errorf("Error parsing policies from %s: %v", path, err)
+	}
+	if len(policyFile.Policies) == 0 {
+		return nil, fmt.Errorf("No policies found in %s", path)
+	}
+	names := map[string]bool{}
+	for _, policy := range policyFile.Policies {
+		if policy.Name == "" {
+			return nil, fmt.Errorf("Policy in %s is missing a name", path)
+		}
+		if names[policy.Name] {
+			return nil, fmt.Errorf("Duplicate policy name %s in %s", policy.Name, path)
+		}
+		names[policy.Name] = true
+		if err := policy.Memory.validate(); err != nil {
+			return nil, fmt.Errorf("Invalid memory policy %s: %v", policy.Name, err)
+		}
+		if err := policy.CPU.validate(); err != nil {
+			return nil, fmt.Errorf("Invalid cpu policy %s: %v", policy.Name, err)
+		}
+		if policy.Baseline != "" && policy.Baseline != allocatableBaseline && policy.Baseline != capacityBaseline {
+			return nil, fmt.Errorf("Invalid baseline %q for policy %s, must be %s or %s", policy.Baseline, policy.Name, allocatableBaseline, capacityBaseline)
+		}
+		for signal, threshold := range policy.EvictionHard {
+			if _, ok := evictionSignalResources[signal]; !ok {
+				return nil, fmt.Errorf("Unsupported eviction signal %s for policy %s", signal, policy.Name)
+			}
+			if _, err := parseEvictionThreshold(threshold, 0); err != nil {
+				return nil, fmt.Errorf("Invalid eviction threshold for policy %s: %v", policy.Name, err)
+			}
+		}
+	}
+	return policyFile.Policies, nil
+}
+
+func (r resourcePolicy) validate() error {
+	for i, bracket := range r.Brackets {
+		if bracket.MarginalReservedRate < 0 || bracket.MarginalReservedRate > 1 {
+			return fmt.Errorf("marginalReservedRate %v must be between 0 and 1", bracket.MarginalReservedRate)
+		}
+		if i > 0 && bracket.Threshold <= r.Brackets[i-1].Threshold {
+			return fmt.Errorf("bracket thresholds must be increasing, but %d follows %d", bracket.Threshold, r.Brackets[i-1].Threshold)
+		}
+	}
+	return nil
+}
+
+func (r resourcePolicy) reserved(capacity int64) int64 {
+	if capacity <= r.MinCapacity {
+		return 0
+	}
+	return calculateReserved(capacity, r.Brackets)
+}
+
+// proposedAllocatable returns the allocatable a node would have under the
+// policy.  The value is in millicores for CPU, and in the base unit of all
+// other resources.  Legacy scraper output has no capacity, so allocatable is
+// used as the capacity in that case.
+func (p reservationPolicy) proposedAllocatable(name v1.ResourceName, na *types.NodeAllocated) int64 {
+	baseline := types.QuantityValue(name, na.Allocatable[name])
+	capacity := na.Capacity[name]
+	if p.Baseline == capacityBaseline && !capacity.IsZero() {
+		baseline = types.QuantityValue(name, capacity)
+		if name == v1.ResourceMemory {
+			// like the kubelet, pre-allocated huge pages are not allocatable memory
+			for hugePages, quantity := range na.Capacity {
+				if strings.HasPrefix(string(hugePages), v1.ResourceHugePagesPrefix) {
+					baseline -= quantity.Value()
+				}
+			}
+		}
+	}
+	proposed := baseline - p.reserved(name, baseline)
+	if proposed < 0 {
+		return 0
+	}
+	return proposed
+}
+
+// reserved returns the sum of the bracket based reservation, kube and system
+// reserved, and hard eviction thresholds for the resource.
+func (p reservationPolicy) reserved(name v1.ResourceName, baseline int64) int64 {
+	reserved := int64(0)
+	switch name {
+	case v1.ResourceCPU:
+		reserved += p.CPU.reserved(baseline)
+	case v1.ResourceMemory:
+		reserved += p.Memory.reserved(baseline/mbPerGB/mbPerGB) * mbPerGB * mbPerGB
+	}
+	reserved += types.QuantityValue(name, p.KubeReserved[name])
+	reserved += types.QuantityValue(name, p.SystemReserved[name])
+	for signal, threshold := range p.EvictionHard {
+		if evictionSignalResources[signal] == name {
+			// thresholds are validated when the policies are loaded
+			evictionReserved, _ := parseEvictionThreshold(threshold, baseline)
+			reserved += evictionReserved
+		}
+	}
+	return reserved
+}
+
+// parseEvictionThreshold parses a threshold which is either a quantity, or a
+// percentage of capacity.
+func parseEvictionThreshold(threshold string, capacity int64) (int64, error) {
+	if strings.HasSuffix(threshold, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(threshold, "%"), 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return 0, fmt.Errorf("invalid percentage %s", threshold)
+		}
+		return int64(float64(capacity) * percent / 100), nil
+	}
+	quantity, err := resourceapi.ParseQuantity(threshold)
+	if err != nil {
+		return 0, fmt.Errorf("invalid quantity %s: %v", threshold, err)
+	}
+	return quantity.Value(), nil
+}
+
+// calculateReserved calculates reserved using capacity and a series of
+// brackets as follows:  the marginalReservedRate applies to all capacity
+// greater than the bracket, but less than the next bracket.  For example, if
+// the first bracket is threshold: 0, rate:0.1, and the second bracket has
+// threshold: 100, rate: 0.4, a capacity of 100 results in a reserved of
+// 100*0.1 = 10, but a capacity of 200 results in a reserved of
+// 10 + (200-100)*.4 = 50.  Using brackets with marginal rates ensures that as
+// capacity increases, reserved always increases, and never decreases.
+func calculateReserved(capacity int64, brackets []allocatableBracket) int64 {
+	var reserved float64
+	for i, bracket := range brackets {
+		c := capacity
+		if i < len(brackets)-1 && brackets[i+1].Threshold < capacity {
+			c = brackets[i+1].Threshold
+		}
+		additionalReserved := float64(c-bracket.Threshold) * bracket.MarginalReservedRate
+		if additionalReserved > 0 {
+			reserved += additionalReserved
+		}
+	}
+	return int64(reserved)
+}
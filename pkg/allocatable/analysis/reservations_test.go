@@ -0,0 +1,387 @@
+package analysis
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	resourceapi "k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/dashpole/allocatable/pkg/allocatable/types"
+)
+
+func TestLoadReservationPolicies(t *testing.T) {
+	testCases := []struct {
+		name      string
+		contents  string
+		want      []reservationPolicy
+		wantError bool
+	}{
+		{
+			name: "valid yaml",
+			contents: `policies:
+- name: kubelet
+  baseline: capacity
+  memory:
+    minCapacity: 512
+    brackets:
+    - {threshold: 0, marginalReservedRate: 0.1}
+    - {threshold: 1024, marginalReservedRate: 0.05}
+  cpu:
+    brackets:
+    - {threshold: 0, marginalReservedRate: 0.01}
+  kubeReserved: {cpu: 100m, memory: 1Gi}
+  systemReserved: {memory: 512Mi}
+  evictionHard: {memory.available: 10%, nodefs.available: 1Gi}
+- name: flat
+`,
+			want: []reservationPolicy{
+				{
+					Name:     "kubelet",
+					Baseline: capacityBaseline,
+					Memory: resourcePolicy{
+						MinCapacity: 512,
+						Brackets:    []allocatableBracket{{Threshold: 0, MarginalReservedRate: 0.1}, {Threshold: 1024, MarginalReservedRate: 0.05}},
+					},
+					CPU: resourcePolicy{
+						Brackets: []allocatableBracket{{Threshold: 0, MarginalReservedRate: 0.01}},
+					},
+					KubeReserved:   v1.ResourceList{v1.ResourceCPU: resourceapi.MustParse("100m"), v1.ResourceMemory: resourceapi.MustParse("1Gi")},
+					SystemReserved: v1.ResourceList{v1.ResourceMemory: resourceapi.MustParse("512Mi")},
+					EvictionHard:   map[string]string{"memory.available": "10%", "nodefs.available": "1Gi"},
+				},
+				{Name: "flat"},
+			},
+		},
+		{
+			name:     "valid json",
+			contents: `{"policies": [{"name": "json", "baseline": "allocatable", "cpu": {"brackets": [{"threshold": 0, "marginalReservedRate": 0.5}]}}]}`,
+			want: []reservationPolicy{
+				{
+					Name:     "json",
+					Baseline: allocatableBaseline,
+					CPU:      resourcePolicy{Brackets: []allocatableBracket{{Threshold: 0, MarginalReservedRate: 0.5}}},
+				},
+			},
+		},
+		{name: "unknown policy field", contents: "policies:\n- name: a\n  reserved: 10\n", wantError: true},
+		{name: "unknown bracket field", contents: "policies:\n- name: a\n  cpu:\n    brackets:\n    - {threshold: 0, rate: 0.1}\n", wantError: true},
+		{name: "unknown top level field", contents: "policy:\n- name: a\n", wantError: true},
+		{name: "malformed yaml", contents: "policies:\n- name: [a\n", wantError: true},
+		{name: "wrong type", contents: "policies:\n- name: a\n  cpu:\n    minCapacity: lots\n", wantError: true},
+		{name: "invalid quantity", contents: "policies:\n- name: a\n  kubeReserved: {cpu: lots}\n", wantError: true},
+		{name: "no policies", contents: "policies: []\n", wantError: true},
+		{name: "missing name", contents: "policies:\n- baseline: capacity\n", wantError: true},
+		{name: "duplicate name", contents: "policies:\n- name: a\n- name: a\n", wantError: true},
+		{name: "invalid baseline", contents: "policies:\n- name: a\n  baseline: requests\n", wantError: true},
+		{name: "negative rate", contents: "policies:\n- name: a\n  memory:\n    brackets:\n    - {threshold: 0, marginalReservedRate: -0.1}\n", wantError: true},
+		{name: "rate above one", contents: "policies:\n- name: a\n  cpu:\n    brackets:\n    - {threshold: 0, marginalReservedRate: 1.5}\n", wantError: true},
+		{
+			name:      "decreasing thresholds",
+			contents:  "policies:\n- name: a\n  cpu:\n    brackets:\n    - {threshold: 100, marginalReservedRate: 0.1}\n    - {threshold: 100, marginalReservedRate: 0.2}\n",
+			wantError: true,
+		},
+		{name: "unsupported eviction signal", contents: "policies:\n- name: a\n  evictionHard: {pid.available: 10%}\n", wantError: true},
+		{name: "invalid eviction percentage", contents: "policies:\n- name: a\n  evictionHard: {memory.available: 110%}\n", wantError: true},
+		{name: "invalid eviction quantity", contents: "policies:\n- name: a\n  evictionHard: {nodefs.available: lots}\n", wantError: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policies.yaml")
+			if err := os.WriteFile(path, []byte(tc.contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := loadReservationPolicies(path)
+			if tc.wantError {
+				if err == nil {
+					t.Fatalf("loadReservationPolicies() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadReservationPolicies() returned error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("loadReservationPolicies() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadReservationPoliciesDefault(t *testing.T) {
+	got, err := loadReservationPolicies("")
+	if err != nil {
+		t.Fatalf("loadReservationPolicies() returned error: %v", err)
+	}
+	if !reflect.DeepEqual(got, []reservationPolicy{defaultReservationPolicy}) {
+		t.Errorf("loadReservationPolicies() = %+v, want only the default policy", got)
+	}
+	if _, err := loadReservationPolicies(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("loadReservationPolicies() of a missing file succeeded, want an error")
+	}
+}
+
+func TestCalculateReserved(t *testing.T) {
+	brackets := []allocatableBracket{{Threshold: 0, MarginalReservedRate: 0.1}, {Threshold: 100, MarginalReservedRate: 0.4}}
+	testCases := []struct {
+		capacity int64
+		want     int64
+	}{
+		{capacity: 0, want: 0},
+		{capacity: 50, want: 5},
+		{capacity: 100, want: 10},
+		{capacity: 200, want: 50},
+	}
+	for _, tc := range testCases {
+		if got := calculateReserved(tc.capacity, brackets); got != tc.want {
+			t.Errorf("calculateReserved(%d) = %d, want %d", tc.capacity, got, tc.want)
+		}
+	}
+}
+
+// TestDefaultReservationPolicy checks that the default policy reserves the
+// same memory (in MB) and CPU (in millicores) as the hard-coded reservations
+// it replaced.
+func TestDefaultReservationPolicy(t *testing.T) {
+	memoryTestCases := []struct {
+		capacityMB int64
+		wantMB     int64
+	}{
+		{capacityMB: 512, wantMB: 0},
+		{capacityMB: 1 * mbPerGB, wantMB: 0},
+		{capacityMB: 2 * mbPerGB, wantMB: 512},
+		{capacityMB: 4 * mbPerGB, wantMB: 1024},
+		{capacityMB: 8 * mbPerGB, wantMB: 1843},
+		{capacityMB: 16 * mbPerGB, wantMB: 2662},
+		{capacityMB: 32 * mbPerGB, wantMB: 3645},
+		{capacityMB: 128 * mbPerGB, wantMB: 9543},
+		{capacityMB: 256 * mbPerGB, wantMB: 12165},
+	}
+	for _, tc := range memoryTestCases {
+		if got := defaultReservationPolicy.Memory.reserved(tc.capacityMB); got != tc.wantMB {
+			t.Errorf("memory reserved for %dMB = %dMB, want %dMB", tc.capacityMB, got, tc.wantMB)
+		}
+		capacity := tc.capacityMB * mbPerGB * mbPerGB
+		if got := defaultReservationPolicy.reserved(v1.ResourceMemory, capacity); got != tc.wantMB*mbPerGB*mbPerGB {
+			t.Errorf("memory reserved for %d bytes = %d, want %dMi", capacity, got, tc.wantMB)
+		}
+	}
+
+	cpuTestCases := []struct {
+		capacityMillicores int64
+		wantMillicores     int64
+	}{
+		{capacityMillicores: 500, wantMillicores: 30},
+		{capacityMillicores: 1 * millicoresPerCore, wantMillicores: 60},
+		{capacityMillicores: 2 * millicoresPerCore, wantMillicores: 70},
+		{capacityMillicores: 4 * millicoresPerCore, wantMillicores: 80},
+		{capacityMillicores: 8 * millicoresPerCore, wantMillicores: 90},
+		{capacityMillicores: 32 * millicoresPerCore, wantMillicores: 150},
+	}
+	for _, tc := range cpuTestCases {
+		if got := defaultReservationPolicy.reserved(v1.ResourceCPU, tc.capacityMillicores); got != tc.wantMillicores {
+			t.Errorf("cpu reserved for %dm = %dm, want %dm", tc.capacityMillicores, got, tc.wantMillicores)
+		}
+	}
+
+	// the default policy only reserves memory and cpu
+	if got := defaultReservationPolicy.reserved(v1.ResourceEphemeralStorage, 100*mbPerGB*mbPerGB*mbPerGB); got != 0 {
+		t.Errorf("ephemeral-storage reserved = %d, want 0", got)
+	}
+}
+
+func TestProposedAllocatable(t *testing.T) {
+	const gi = 1 << 30
+	node := types.NodeAllocated{
+		NodeName: "a",
+		Capacity: v1.ResourceList{
+			v1.ResourceCPU:              resourceapi.MustParse("2"),
+			v1.ResourceMemory:           resourceapi.MustParse("10Gi"),
+			v1.ResourceEphemeralStorage: resourceapi.MustParse("100Gi"),
+		},
+		Allocatable: v1.ResourceList{
+			v1.ResourceCPU:              resourceapi.MustParse("1930m"),
+			v1.ResourceMemory:           resourceapi.MustParse("8Gi"),
+			v1.ResourceEphemeralStorage: resourceapi.MustParse("80Gi"),
+		},
+	}
+	hugePagesNode := types.NodeAllocated{
+		NodeName: "b",
+		Capacity: v1.ResourceList{
+			v1.ResourceMemory: resourceapi.MustParse("10Gi"),
+			"hugepages-2Mi":   resourceapi.MustParse("1Gi"),
+			"hugepages-1Gi":   resourceapi.MustParse("2Gi"),
+		},
+		Allocatable: v1.ResourceList{
+			v1.ResourceMemory: resourceapi.MustParse("6Gi"),
+			"hugepages-2Mi":   resourceapi.MustParse("1Gi"),
+			"hugepages-1Gi":   resourceapi.MustParse("2Gi"),
+		},
+	}
+	legacyNode := types.NodeAllocated{
+		NodeName:    "c",
+		Allocatable: v1.ResourceList{v1.ResourceMemory: resourceapi.MustParse("8Gi")},
+	}
+	kubeReserved := v1.ResourceList{v1.ResourceCPU: resourceapi.MustParse("100m"), v1.ResourceMemory: resourceapi.MustParse("1Gi")}
+	testCases := []struct {
+		name     string
+		policy   reservationPolicy
+		resource v1.ResourceName
+		node     types.NodeAllocated
+		want     int64
+	}{
+		{name: "empty policy keeps allocatable", resource: v1.ResourceMemory, node: node, want: 8 * gi},
+		{name: "empty policy keeps allocatable cpu", resource: v1.ResourceCPU, node: node, want: 1930},
+		{
+			name:     "allocatable baseline",
+			policy:   reservationPolicy{Baseline: allocatableBaseline, KubeReserved: kubeReserved},
+			resource: v1.ResourceMemory,
+			node:     node,
+			want:     7 * gi,
+		},
+		{
+			name:     "allocatable baseline cpu",
+			policy:   reservationPolicy{KubeReserved: kubeReserved},
+			resource: v1.ResourceCPU,
+			node:     node,
+			want:     1830,
+		},
+		{
+			name:     "capacity baseline",
+			policy:   reservationPolicy{Baseline: capacityBaseline, KubeReserved: kubeReserved, SystemReserved: kubeReserved},
+			resource: v1.ResourceMemory,
+			node:     node,
+			want:     8 * gi,
+		},
+		{
+			name:     "capacity baseline cpu",
+			policy:   reservationPolicy{Baseline: capacityBaseline, KubeReserved: kubeReserved},
+			resource: v1.ResourceCPU,
+			node:     node,
+			want:     1900,
+		},
+		{
+			name:     "capacity baseline subtracts huge pages",
+			policy:   reservationPolicy{Baseline: capacityBaseline, KubeReserved: kubeReserved},
+			resource: v1.ResourceMemory,
+			node:     hugePagesNode,
+			want:     6 * gi,
+		},
+		{
+			name:     "allocatable baseline ignores huge pages",
+			policy:   reservationPolicy{Baseline: allocatableBaseline},
+			resource: v1.ResourceMemory,
+			node:     hugePagesNode,
+			want:     6 * gi,
+		},
+		{
+			name:     "capacity baseline without capacity uses allocatable",
+			policy:   reservationPolicy{Baseline: capacityBaseline, KubeReserved: kubeReserved},
+			resource: v1.ResourceMemory,
+			node:     legacyNode,
+			want:     7 * gi,
+		},
+		{
+			name:     "percentage memory eviction threshold",
+			policy:   reservationPolicy{Baseline: capacityBaseline, EvictionHard: map[string]string{"memory.available": "10%"}},
+			resource: v1.ResourceMemory,
+			node:     node,
+			want:     9 * gi,
+		},
+		{
+			name:     "percentage memory eviction threshold excludes huge pages",
+			policy:   reservationPolicy{Baseline: capacityBaseline, EvictionHard: map[string]string{"memory.available": "50%"}},
+			resource: v1.ResourceMemory,
+			node:     hugePagesNode,
+			want:     7 * gi / 2,
+		},
+		{
+			name:     "percentage ephemeral-storage eviction threshold",
+			policy:   reservationPolicy{Baseline: capacityBaseline, EvictionHard: map[string]string{"nodefs.available": "10%"}},
+			resource: v1.ResourceEphemeralStorage,
+			node:     node,
+			want:     90 * gi,
+		},
+		{
+			name:     "percentage eviction threshold of allocatable",
+			policy:   reservationPolicy{EvictionHard: map[string]string{"nodefs.available": "25%"}},
+			resource: v1.ResourceEphemeralStorage,
+			node:     node,
+			want:     60 * gi,
+		},
+		{
+			name:     "absolute memory eviction threshold",
+			policy:   reservationPolicy{Baseline: capacityBaseline, EvictionHard: map[string]string{"memory.available": "512Mi"}},
+			resource: v1.ResourceMemory,
+			node:     node,
+			want:     10*gi - gi/2,
+		},
+		{
+			name:     "absolute ephemeral-storage eviction threshold",
+			policy:   reservationPolicy{Baseline: capacityBaseline, EvictionHard: map[string]string{"nodefs.available": "1Gi"}},
+			resource: v1.ResourceEphemeralStorage,
+			node:     node,
+			want:     99 * gi,
+		},
+		{
+			name:     "eviction thresholds only apply to their resource",
+			policy:   reservationPolicy{Baseline: capacityBaseline, EvictionHard: map[string]string{"nodefs.available": "10%"}},
+			resource: v1.ResourceMemory,
+			node:     node,
+			want:     10 * gi,
+		},
+		{
+			name:     "reserved beyond the baseline",
+			policy:   reservationPolicy{SystemReserved: v1.ResourceList{v1.ResourceMemory: resourceapi.MustParse("20Gi")}},
+			resource: v1.ResourceMemory,
+			node:     node,
+			want:     0,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.policy.proposedAllocatable(tc.resource, &tc.node); got != tc.want {
+				t.Errorf("proposedAllocatable(%s) = %d, want %d", tc.resource, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseEvictionThreshold(t *testing.T) {
+	testCases := []struct {
+		threshold string
+		capacity  int64
+		want      int64
+		wantError bool
+	}{
+		{threshold: "10%", capacity: 1000, want: 100},
+		{threshold: "0.5%", capacity: 1000, want: 5},
+		{threshold: "0%", capacity: 1000, want: 0},
+		{threshold: "100%", capacity: 1000, want: 1000},
+		{threshold: "100Mi", capacity: 1000, want: 100 << 20},
+		{threshold: "1G", want: 1000 * 1000 * 1000},
+		{threshold: "0", want: 0},
+		{threshold: "-1%", capacity: 1000, wantError: true},
+		{threshold: "101%", capacity: 1000, wantError: true},
+		{threshold: "ten%", capacity: 1000, wantError: true},
+		{threshold: "%", capacity: 1000, wantError: true},
+		{threshold: "lots", wantError: true},
+		{threshold: "", wantError: true},
+	}
+	for _, tc := range testCases {
+		got, err := parseEvictionThreshold(tc.threshold, tc.capacity)
+		if tc.wantError {
+			if err == nil {
+				t.Errorf("parseEvictionThreshold(%q) = %d, want an error", tc.threshold, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseEvictionThreshold(%q) returned error: %v", tc.threshold, err)
+		} else if got != tc.want {
+			t.Errorf("parseEvictionThreshold(%q, %d) = %d, want %d", tc.threshold, tc.capacity, got, tc.want)
+		}
+	}
+}
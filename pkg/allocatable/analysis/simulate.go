@@ -0,0 +1,180 @@
+package analysis
+
+import (
+	"sort"
+
+	"k8s.io/api/core/v1"
+
+	"github.com/dashpole/allocatable/pkg/allocatable/types"
+)
+
+// qosEvictionRank orders QoS classes by how early their pods are evicted.
+var qosEvictionRank = map[v1.PodQOSClass]int{
+	v1.PodQOSBestEffort: 0,
+	v1.PodQOSBurstable:  1,
+	v1.PodQOSGuaranteed: 2,
+}
+
+// simPod is a pod in the simulation, with its requests in the units used by
+// types.QuantityValue.  Every pod requests one of its node's allocatable pods.
+type simPod struct {
+	priority int32
+	qosClass v1.PodQOSClass
+	requests map[v1.ResourceName]int64
+}
+
+func newSimPod(pod types.PodAllocated) simPod {
+	requests := map[v1.ResourceName]int64{v1.ResourcePods: 1}
+	for name, quantity := range pod.Requests {
+		requests[name] += types.QuantityValue(name, quantity)
+	}
+	return simPod{
+		priority: pod.Priority,
+		qosClass: pod.QOSClass,
+		requests: requests,
+	}
+}
+
+// evictedBefore returns true if the pod is evicted before the other pod: lower
+// priority first, then lower QoS class, then larger pods, as evicting them
+// frees the most resources.
+func (p simPod) evictedBefore(other simPod) bool {
+	if p.priority != other.priority {
+		return p.priority < other.priority
+	}
+	if qosEvictionRank[p.qosClass] != qosEvictionRank[other.qosClass] {
+		return qosEvictionRank[p.qosClass] < qosEvictionRank[other.qosClass]
+	}
+	return p.size() > other.size()
+}
+
+// size is used to order pods of the same priority and QoS class.
+func (p simPod) size() int64 {
+	return p.requests[v1.ResourceCPU] + p.requests[v1.ResourceMemory]/(mbPerGB*mbPerGB)
+}
+
+// simNode tracks the proposed allocatable that is still free on a node.
+type simNode struct {
+	free map[v1.ResourceName]int64
+}
+
+func (n simNode) fits(pod simPod) bool {
+	for name, request := range pod.requests {
+		if request > n.free[name] {
+			return false
+		}
+	}
+	return true
+}
+
+func (n simNode) add(pod simPod) {
+	for name, request := range pod.requests {
+		n.free[name] -= request
+	}
+}
+
+func (n simNode) remove(pod simPod) {
+	for name, request := range pod.requests {
+		n.free[name] += request
+	}
+}
+
+// overcommitted returns the resources whose requests exceed the proposed allocatable.
+func (n simNode) overcommitted() map[v1.ResourceName]bool {
+	over := map[v1.ResourceName]bool{}
+	for name, free := range n.free {
+		if free < 0 {
+			over[name] = true
+		}
+	}
+	return over
+}
+
+// simulateDisplacement evicts pods from nodes whose pods do not fit within
+// the proposed allocatable in nodeStats, and then tries to schedule the
+// evicted pods on the other nodes in the cluster based on their requests.  It
+// sets EvictedPods on nodeStats, and returns the number of evicted pods and
+// the number of evicted pods which could not be scheduled.  It returns false
+// if the scraper output did not include pods.
+func simulateDisplacement(c types.ClusterAllocated, nodeStats []types.NodeStats) (displaced, unschedulable int, simulated bool) {
+	nodes := []simNode{}
+	evicted := []simPod{}
+	for i, na := range c {
+		numPods, ok := na.Requests[v1.ResourcePods]
+		if !ok || numPods.Value() != int64(len(na.Pods)) {
+			return 0, 0, false
+		}
+		node := simNode{free: map[v1.ResourceName]int64{}}
+		for name, r := range nodeStats[i].Resources {
+			node.free[name] = r.Proposed
+		}
+		pods := []simPod{}
+		for _, pod := range na.Pods {
+			p := newSimPod(pod)
+			node.add(p)
+			pods = append(pods, p)
+		}
+		nodeEvicted := evictPods(node, pods)
+		nodeStats[i].EvictedPods = len(nodeEvicted)
+		evicted = append(evicted, nodeEvicted...)
+		nodes = append(nodes, node)
+	}
+
+	// schedule the most important pods first
+	sort.SliceStable(evicted, func(i, j int) bool { return evicted[j].evictedBefore(evicted[i]) })
+	for _, pod := range evicted {
+		scheduled := false
+		for _, node := range nodes {
+			if node.fits(pod) {
+				node.add(pod)
+				scheduled = true
+				break
+			}
+		}
+		if !scheduled {
+			unschedulable++
+		}
+	}
+	return len(evicted), unschedulable, true
+}
+
+// evictPods removes pods from the node until the rest fit, and returns the
+// evicted pods.  Only pods which request an overcommitted resource are
+// evicted, and evicted pods which fit once others have been evicted are put
+// back, so that as few pods as possible are evicted.
+func evictPods(node simNode, pods []simPod) []simPod {
+	over := node.overcommitted()
+	if len(over) == 0 {
+		return nil
+	}
+	sort.SliceStable(pods, func(i, j int) bool { return pods[i].evictedBefore(pods[j]) })
+	evicted := []simPod{}
+	for _, pod := range pods {
+		if len(node.overcommitted()) == 0 {
+			break
+		}
+		if !requestsAny(pod, over) {
+			continue
+		}
+		node.remove(pod)
+		evicted = append(evicted, pod)
+	}
+	stillEvicted := []simPod{}
+	for i := len(evicted) - 1; i >= 0; i-- {
+		if node.fits(evicted[i]) {
+			node.add(evicted[i])
+			continue
+		}
+		stillEvicted = append(stillEvicted, evicted[i])
+	}
+	return stillEvicted
+}
+
+func requestsAny(pod simPod, resources map[v1.ResourceName]bool) bool {
+	for name, request := range pod.requests {
+		if request > 0 && resources[name] {
+			return true
+		}
+	}
+	return false
+}
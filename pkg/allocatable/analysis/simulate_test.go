@@ -0,0 +1,240 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	resourceapi "k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/dashpole/allocatable/pkg/allocatable/types"
+)
+
+// testSimPod returns a pod which requests cpu millicores.
+func testSimPod(priority int32, qosClass v1.PodQOSClass, cpu int64) simPod {
+	return simPod{priority: priority, qosClass: qosClass, requests: map[v1.ResourceName]int64{v1.ResourcePods: 1, v1.ResourceCPU: cpu}}
+}
+
+// testSimNode returns a node with the free resources, with the pods added.
+func testSimNode(free map[v1.ResourceName]int64, pods []simPod) simNode {
+	node := simNode{free: map[v1.ResourceName]int64{v1.ResourcePods: 110}}
+	for name, value := range free {
+		node.free[name] = value
+	}
+	for _, pod := range pods {
+		node.add(pod)
+	}
+	return node
+}
+
+func TestEvictPods(t *testing.T) {
+	memoryPod := simPod{priority: 1, qosClass: v1.PodQOSBurstable, requests: map[v1.ResourceName]int64{v1.ResourcePods: 1, v1.ResourceMemory: 1 << 30}}
+	testCases := []struct {
+		name        string
+		free        map[v1.ResourceName]int64
+		pods        []simPod
+		wantEvicted []simPod
+	}{
+		{
+			name: "pods fit",
+			free: map[v1.ResourceName]int64{v1.ResourceCPU: 1000},
+			pods: []simPod{testSimPod(0, v1.PodQOSBurstable, 500), testSimPod(0, v1.PodQOSBurstable, 500)},
+		},
+		{
+			name: "lowest priority first",
+			free: map[v1.ResourceName]int64{v1.ResourceCPU: 1000},
+			pods: []simPod{
+				testSimPod(10, v1.PodQOSBestEffort, 500),
+				testSimPod(0, v1.PodQOSGuaranteed, 500),
+				testSimPod(5, v1.PodQOSBurstable, 500),
+			},
+			wantEvicted: []simPod{testSimPod(0, v1.PodQOSGuaranteed, 500)},
+		},
+		{
+			name: "lowest qos class first within a priority",
+			free: map[v1.ResourceName]int64{v1.ResourceCPU: 1000},
+			pods: []simPod{
+				testSimPod(0, v1.PodQOSGuaranteed, 500),
+				testSimPod(0, v1.PodQOSBurstable, 500),
+				testSimPod(0, v1.PodQOSBestEffort, 500),
+			},
+			wantEvicted: []simPod{testSimPod(0, v1.PodQOSBestEffort, 500)},
+		},
+		{
+			name: "largest pod first within a qos class",
+			free: map[v1.ResourceName]int64{v1.ResourceCPU: 1000},
+			pods: []simPod{
+				testSimPod(0, v1.PodQOSBurstable, 300),
+				testSimPod(0, v1.PodQOSBurstable, 600),
+				testSimPod(0, v1.PodQOSBurstable, 500),
+			},
+			wantEvicted: []simPod{testSimPod(0, v1.PodQOSBurstable, 600)},
+		},
+		{
+			name: "pods are put back once they fit",
+			free: map[v1.ResourceName]int64{v1.ResourceCPU: 1000},
+			pods: []simPod{
+				testSimPod(0, v1.PodQOSBurstable, 100),
+				testSimPod(1, v1.PodQOSBurstable, 800),
+				testSimPod(2, v1.PodQOSBurstable, 500),
+			},
+			wantEvicted: []simPod{testSimPod(1, v1.PodQOSBurstable, 800)},
+		},
+		{
+			name: "several pods evicted",
+			free: map[v1.ResourceName]int64{v1.ResourceCPU: 500},
+			pods: []simPod{
+				testSimPod(0, v1.PodQOSBurstable, 400),
+				testSimPod(1, v1.PodQOSBurstable, 400),
+				testSimPod(2, v1.PodQOSBurstable, 400),
+			},
+			wantEvicted: []simPod{testSimPod(1, v1.PodQOSBurstable, 400), testSimPod(0, v1.PodQOSBurstable, 400)},
+		},
+		{
+			name: "only pods requesting an overcommitted resource",
+			free: map[v1.ResourceName]int64{v1.ResourceCPU: 1000, v1.ResourceMemory: 512 << 20},
+			pods: []simPod{
+				testSimPod(0, v1.PodQOSBestEffort, 500),
+				memoryPod,
+			},
+			wantEvicted: []simPod{memoryPod},
+		},
+		{
+			name: "no evictable pods",
+			free: map[v1.ResourceName]int64{v1.ResourceCPU: 1000, v1.ResourceMemory: -1},
+			pods: []simPod{testSimPod(0, v1.PodQOSBestEffort, 500)},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			evicted := evictPods(testSimNode(tc.free, tc.pods), tc.pods)
+			if len(evicted) == 0 && len(tc.wantEvicted) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(evicted, tc.wantEvicted) {
+				t.Errorf("evictPods() = %+v, want %+v", evicted, tc.wantEvicted)
+			}
+		})
+	}
+}
+
+// testNode returns a node with the proposed cpu allocatable, and the stats
+// used by simulateDisplacement.
+func testNode(name string, proposedCPU int64, pods ...types.PodAllocated) (types.NodeAllocated, types.NodeStats) {
+	na := types.NodeAllocated{
+		NodeName: name,
+		Requests: v1.ResourceList{v1.ResourcePods: *resourceapi.NewQuantity(int64(len(pods)), resourceapi.DecimalSI)},
+		Pods:     pods,
+	}
+	stats := types.NodeStats{
+		NodeName: name,
+		Resources: map[v1.ResourceName]types.NodeResourceStats{
+			v1.ResourceCPU:  {Proposed: proposedCPU},
+			v1.ResourcePods: {Proposed: 110},
+		},
+	}
+	return na, stats
+}
+
+func testPod(name, cpu string) types.PodAllocated {
+	return types.PodAllocated{Name: name, QOSClass: v1.PodQOSBurstable, Requests: v1.ResourceList{v1.ResourceCPU: resourceapi.MustParse(cpu)}}
+}
+
+func TestSimulateDisplacement(t *testing.T) {
+	type node struct {
+		proposedCPU int64
+		pods        []types.PodAllocated
+	}
+	testCases := []struct {
+		name              string
+		nodes             []node
+		wantDisplaced     int
+		wantUnschedulable int
+		wantEvicted       []int
+	}{
+		{
+			name: "pods fit",
+			nodes: []node{
+				{proposedCPU: 1000, pods: []types.PodAllocated{testPod("a", "500m"), testPod("b", "500m")}},
+				{proposedCPU: 1000},
+			},
+			wantEvicted: []int{0, 0},
+		},
+		{
+			name: "evicted pod is rescheduled",
+			nodes: []node{
+				{proposedCPU: 1000, pods: []types.PodAllocated{testPod("a", "800m"), testPod("b", "400m")}},
+				{proposedCPU: 1000, pods: []types.PodAllocated{testPod("c", "200m")}},
+			},
+			wantDisplaced: 1,
+			wantEvicted:   []int{1, 0},
+		},
+		{
+			name: "evicted pod is unschedulable",
+			nodes: []node{
+				{proposedCPU: 1000, pods: []types.PodAllocated{testPod("a", "800m"), testPod("b", "400m")}},
+				{proposedCPU: 1000, pods: []types.PodAllocated{testPod("c", "500m")}},
+			},
+			wantDisplaced:     1,
+			wantUnschedulable: 1,
+			wantEvicted:       []int{1, 0},
+		},
+		{
+			name: "rescheduled pods fill other nodes",
+			nodes: []node{
+				{proposedCPU: 0, pods: []types.PodAllocated{testPod("a", "600m"), testPod("b", "600m")}},
+				{proposedCPU: 1000},
+			},
+			wantDisplaced:     2,
+			wantUnschedulable: 1,
+			wantEvicted:       []int{2, 0},
+		},
+		{
+			name: "node with no pods",
+			nodes: []node{
+				{proposedCPU: 0},
+				{proposedCPU: 1000, pods: []types.PodAllocated{testPod("a", "100m")}},
+			},
+			wantEvicted: []int{0, 0},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := types.ClusterAllocated{}
+			nodeStats := []types.NodeStats{}
+			for i, n := range tc.nodes {
+				na, stats := testNode(string(rune('a'+i)), n.proposedCPU, n.pods...)
+				c = append(c, na)
+				nodeStats = append(nodeStats, stats)
+			}
+			displaced, unschedulable, simulated := simulateDisplacement(c, nodeStats)
+			if !simulated {
+				t.Fatal("simulateDisplacement() did not simulate")
+			}
+			if displaced != tc.wantDisplaced || unschedulable != tc.wantUnschedulable {
+				t.Errorf("simulateDisplacement() = %d displaced, %d unschedulable, want %d, %d", displaced, unschedulable, tc.wantDisplaced, tc.wantUnschedulable)
+			}
+			for i, stats := range nodeStats {
+				if stats.EvictedPods != tc.wantEvicted[i] {
+					t.Errorf("node %s has %d evicted pods, want %d", stats.NodeName, stats.EvictedPods, tc.wantEvicted[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSimulateDisplacementWithoutPods(t *testing.T) {
+	na, stats := testNode("a", 0, testPod("a", "1"))
+	// legacy scraper output has no pods
+	legacy := na
+	legacy.Requests = v1.ResourceList{}
+	legacy.Pods = nil
+	// pods are not written with --include-pods=false
+	missing := na
+	missing.Pods = nil
+	for _, c := range []types.ClusterAllocated{{legacy}, {missing}} {
+		if _, _, simulated := simulateDisplacement(c, []types.NodeStats{stats}); simulated {
+			t.Errorf("simulateDisplacement(%+v) simulated without pods", c)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"k8s.io/api/core/v1"
+
+	"github.com/dashpole/allocatable/pkg/common"
+)
+
+var (
+	// upper bounds of the node size histogram buckets
+	nodeCPUCoresBuckets = []float64{1, 2, 4, 8, 16, 32, 64, 96}
+	nodeMemoryGBBuckets = []float64{1, 2, 4, 8, 16, 32, 64, 128, 256}
+)
+
+// fleetSummary holds summary statistics across all clusters.
+type fleetSummary struct {
+	GroupBy      string            `json:"groupBy,omitempty"`
+	Policies     []*policySummary  `json:"policies"`
+	NodeCPUCores []histogramBucket `json:"nodeCPUCoresHistogram"`
+	NodeMemoryGB []histogramBucket `json:"nodeMemoryGBHistogram"`
+
+	policyNames []string
+	// groups maps a group to its summaries, with one entry per policy
+	groups map[string][]*policySummary
+}
+
+// policySummary holds summary statistics across all clusters in a group for
+// one policy.
+type policySummary struct {
+	Group            string  `json:"group,omitempty"`
+	Policy           string  `json:"policy"`
+	Clusters         int     `json:"clusters"`
+	AffectedClusters int     `json:"affectedClusters"`
+	AffectedPercent  float64 `json:"affectedPercent"`
+	// CPUOverage and MemoryOverage are the distributions of cluster overage
+	// as a fraction of cluster capacity, for clusters with any overage.
+	CPUOverage    percentiles `json:"cpuOverageFraction"`
+	MemoryOverage percentiles `json:"memoryOverageFraction"`
+	// ReclaimedCPU and ReclaimedMemory are the total resources reserved by the
+	// policy beyond what is reserved today, in millicores and bytes.
+	ReclaimedCPU      int64 `json:"reclaimedCPUMillicores"`
+	ReclaimedMemory   int64 `json:"reclaimedMemoryBytes"`
+	DisplacedPods     int   `json:"displacedPods"`
+	UnschedulablePods int   `json:"unschedulablePods"`
+
+	cpuOverageFractions    []float64
+	memoryOverageFractions []float64
+}
+
+type percentiles struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+}
+
+type histogramBucket struct {
+	Bucket string `json:"bucket"`
+	Count  int    `json:"count"`
+
+	// upperBound is inclusive.  The last bucket has no upper bound.
+	upperBound float64
+}
+
+// newFleetSummary returns an empty summary.  Clusters are grouped by the
+// identifier field named by groupBy, or not at all if it is empty.
+func newFleetSummary(policies []reservationPolicy, groupBy string) *fleetSummary {
+	summary := &fleetSummary{
+		GroupBy:      groupBy,
+		NodeCPUCores: newHistogram(nodeCPUCoresBuckets),
+		NodeMemoryGB: newHistogram(nodeMemoryGBBuckets),
+		groups:       map[string][]*policySummary{},
+	}
+	for _, policy := range policies {
+		summary.policyNames = append(summary.policyNames, policy.Name)
+	}
+	return summary
+}
+
+// getGroup returns the summaries for the group, with one entry per policy.
+func (f *fleetSummary) getGroup(group string) []*policySummary {
+	if summaries, ok := f.groups[group]; ok {
+		return summaries
+	}
+	summaries := []*policySummary{}
+	for _, name := range f.policyNames {
+		summaries = append(summaries, &policySummary{Group: group, Policy: name})
+	}
+	f.groups[group] = summaries
+	return summaries
+}
+
+func newHistogram(upperBounds []float64) []histogramBucket {
+	buckets := []histogramBucket{}
+	for _, bound := range upperBounds {
+		buckets = append(buckets, histogramBucket{Bucket: fmt.Sprintf("<= %v", bound), upperBound: bound})
+	}
+	return append(buckets, histogramBucket{
+		Bucket:     fmt.Sprintf("> %v", upperBounds[len(upperBounds)-1]),
+		upperBound: math.Inf(1),
+	})
+}
+
+func observe(buckets []histogramBucket, value float64) {
+	for i := range buckets {
+		if value <= buckets[i].upperBound {
+			buckets[i].Count++
+			return
+		}
+	}
+}
+
+// add adds a cluster, with one entry in result for each policy.
+func (f *fleetSummary) add(result *clusterResult) {
+	summaries := f.getGroup(result.identifier.Group(f.GroupBy))
+	for _, na := range result.nodes {
+		cpu, memory := na.Capacity[v1.ResourceCPU], na.Capacity[v1.ResourceMemory]
+		if cpu.IsZero() {
+			// legacy scraper output has no capacity
+			cpu, memory = na.Allocatable[v1.ResourceCPU], na.Allocatable[v1.ResourceMemory]
+		}
+		observe(f.NodeCPUCores, float64(cpu.MilliValue())/millicoresPerCore)
+		observe(f.NodeMemoryGB, float64(memory.Value())/(mbPerGB*mbPerGB*mbPerGB))
+	}
+	for i, stats := range result.stats {
+		p := summaries[i]
+		p.Clusters++
+		if stats.IsAffected() {
+			p.AffectedClusters++
+		}
+		cpu, memory := stats.Resources[v1.ResourceCPU], stats.Resources[v1.ResourceMemory]
+		if cpu.TotalClusterOverage > 0 && cpu.Capacity > 0 {
+			p.cpuOverageFractions = append(p.cpuOverageFractions, float64(cpu.TotalClusterOverage)/float64(cpu.Capacity))
+		}
+		if memory.TotalClusterOverage > 0 && memory.Capacity > 0 {
+			p.memoryOverageFractions = append(p.memoryOverageFractions, float64(memory.TotalClusterOverage)/float64(memory.Capacity))
+		}
+		p.ReclaimedCPU += cpu.Reserved
+		p.ReclaimedMemory += memory.Reserved
+		p.DisplacedPods += stats.DisplacedPods
+		p.UnschedulablePods += stats.UnschedulablePods
+	}
+}
+
+// finish computes the statistics which depend on every cluster, and orders
+// the summaries by group.
+func (f *fleetSummary) finish() {
+	groups := []string{}
+	for group := range f.groups {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	f.Policies = nil
+	for _, group := range groups {
+		f.Policies = append(f.Policies, f.groups[group]...)
+	}
+	for _, p := range f.Policies {
+		if p.Clusters > 0 {
+			p.AffectedPercent = 100 * float64(p.AffectedClusters) / float64(p.Clusters)
+		}
+		p.CPUOverage = getPercentiles(p.cpuOverageFractions)
+		p.MemoryOverage = getPercentiles(p.memoryOverageFractions)
+	}
+}
+
+// getPercentiles returns the nearest-rank percentiles of values.
+func getPercentiles(values []float64) percentiles {
+	if len(values) == 0 {
+		return percentiles{}
+	}
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	percentile := func(p float64) float64 {
+		rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+		if rank < 0 {
+			rank = 0
+		}
+		return sorted[rank]
+	}
+	return percentiles{
+		P50: percentile(50),
+		P90: percentile(90),
+		P99: percentile(99),
+	}
+}
+
+// writeSummary writes the summary to <prefix>.csv and <prefix>.json.
+func (f *fleetSummary) writeSummary(prefix string) error {
+	if err := common.ToJSON(prefix+".json", f); err != nil {
+		return err
+	}
+	data := [][]string{{"Group", "Policy", "Statistic", "Value"}}
+	formatFloat := func(v float64) string { return strconv.FormatFloat(v, 'f', 4, 64) }
+	for _, p := range f.Policies {
+		for _, row := range [][]string{
+			{"Clusters", strconv.Itoa(p.Clusters)},
+			{"Affected Clusters", strconv.Itoa(p.AffectedClusters)},
+			{"Affected Percent", formatFloat(p.AffectedPercent)},
+			{"CPU Overage Fraction P50", formatFloat(p.CPUOverage.P50)},
+			{"CPU Overage Fraction P90", formatFloat(p.CPUOverage.P90)},
+			{"CPU Overage Fraction P99", formatFloat(p.CPUOverage.P99)},
+			{"Memory Overage Fraction P50", formatFloat(p.MemoryOverage.P50)},
+			{"Memory Overage Fraction P90", formatFloat(p.MemoryOverage.P90)},
+			{"Memory Overage Fraction P99", formatFloat(p.MemoryOverage.P99)},
+			{"Reclaimed CPU", strconv.FormatInt(p.ReclaimedCPU, 10)},
+			{"Reclaimed Memory", strconv.FormatInt(p.ReclaimedMemory, 10)},
+			{"Displaced Pods", strconv.Itoa(p.DisplacedPods)},
+			{"Unschedulable Pods", strconv.Itoa(p.UnschedulablePods)},
+		} {
+			data = append(data, append([]string{p.Group, p.Policy}, row...))
+		}
+	}
+	// node sizes do not depend on the policy
+	for _, histogram := range []struct {
+		name    string
+		buckets []histogramBucket
+	}{
+		{"Nodes With CPU Cores", f.NodeCPUCores},
+		{"Nodes With Memory GB", f.NodeMemoryGB},
+	} {
+		for _, bucket := range histogram.buckets {
+			data = append(data, []string{"", "", histogram.name + " " + bucket.Bucket, strconv.Itoa(bucket.Count)})
+		}
+	}
+	return common.ToCSV(prefix+".csv", data)
+}
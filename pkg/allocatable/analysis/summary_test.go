@@ -0,0 +1,113 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	resourceapi "k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/dashpole/allocatable/pkg/allocatable/types"
+	"github.com/dashpole/allocatable/pkg/common"
+)
+
+func TestGetPercentiles(t *testing.T) {
+	testCases := []struct {
+		name   string
+		values []float64
+		want   percentiles
+	}{
+		{name: "empty", want: percentiles{}},
+		{name: "single value", values: []float64{0.3}, want: percentiles{P50: 0.3, P90: 0.3, P99: 0.3}},
+		{name: "two values", values: []float64{0.2, 0.1}, want: percentiles{P50: 0.1, P90: 0.2, P99: 0.2}},
+		{
+			name:   "ten values",
+			values: []float64{10, 9, 8, 7, 6, 5, 4, 3, 2, 1},
+			want:   percentiles{P50: 5, P90: 9, P99: 10},
+		},
+		{
+			name:   "hundred values",
+			values: hundredValues(),
+			want:   percentiles{P50: 50, P90: 90, P99: 99},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			values := append([]float64(nil), tc.values...)
+			if got := getPercentiles(tc.values); got != tc.want {
+				t.Errorf("getPercentiles(%v) = %+v, want %+v", tc.values, got, tc.want)
+			}
+			if !reflect.DeepEqual(values, tc.values) {
+				t.Errorf("getPercentiles() modified its input to %v", tc.values)
+			}
+		})
+	}
+}
+
+// hundredValues returns 1 to 100 in reverse order.
+func hundredValues() []float64 {
+	values := []float64{}
+	for i := 100; i > 0; i-- {
+		values = append(values, float64(i))
+	}
+	return values
+}
+
+func TestHistogram(t *testing.T) {
+	buckets := newHistogram([]float64{1, 2, 4})
+	for _, value := range []float64{0, 0.5, 1, 1.01, 2, 3.99, 4, 4.01, 96} {
+		observe(buckets, value)
+	}
+	want := []struct {
+		bucket string
+		count  int
+	}{
+		{bucket: "<= 1", count: 3},
+		{bucket: "<= 2", count: 2},
+		{bucket: "<= 4", count: 2},
+		{bucket: "> 4", count: 2},
+	}
+	if len(buckets) != len(want) {
+		t.Fatalf("got %d buckets, want %d", len(buckets), len(want))
+	}
+	for i, w := range want {
+		if buckets[i].Bucket != w.bucket || buckets[i].Count != w.count {
+			t.Errorf("bucket %d = %s with %d, want %s with %d", i, buckets[i].Bucket, buckets[i].Count, w.bucket, w.count)
+		}
+	}
+}
+
+func TestFleetSummaryOverageFraction(t *testing.T) {
+	node := types.NodeAllocated{
+		NodeName:    "a",
+		Capacity:    v1.ResourceList{v1.ResourceCPU: resourceapi.MustParse("4"), v1.ResourceMemory: resourceapi.MustParse("16Gi")},
+		Allocatable: v1.ResourceList{v1.ResourceCPU: resourceapi.MustParse("2"), v1.ResourceMemory: resourceapi.MustParse("8Gi")},
+		Requests:    v1.ResourceList{v1.ResourceCPU: resourceapi.MustParse("3"), v1.ResourceMemory: resourceapi.MustParse("4Gi")},
+	}
+	legacyNode := types.NodeAllocated{
+		NodeName:    "b",
+		Allocatable: v1.ResourceList{v1.ResourceCPU: resourceapi.MustParse("2"), v1.ResourceMemory: resourceapi.MustParse("8Gi")},
+		Requests:    v1.ResourceList{v1.ResourceCPU: resourceapi.MustParse("3"), v1.ResourceMemory: resourceapi.MustParse("4Gi")},
+	}
+	policy := reservationPolicy{Name: "flat"}
+	summary := newFleetSummary([]reservationPolicy{policy}, "")
+	for _, c := range []types.ClusterAllocated{{node}, {legacyNode}} {
+		stats, _ := getClusterStats(c, common.ClusterIdentifier{Raw: c[0].NodeName}, policy)
+		summary.add(&clusterResult{nodes: c, stats: []types.ClusterStats{stats}})
+	}
+	summary.finish()
+	if len(summary.Policies) != 1 {
+		t.Fatalf("got %d policy summaries, want 1", len(summary.Policies))
+	}
+	// 1 core over a capacity of 4, and over an allocatable of 2 without capacity
+	want := percentiles{P50: 0.25, P90: 0.5, P99: 0.5}
+	if got := summary.Policies[0].CPUOverage; got != want {
+		t.Errorf("got cpu overage fractions %+v, want %+v", got, want)
+	}
+	if got := summary.Policies[0].MemoryOverage; got != (percentiles{}) {
+		t.Errorf("got memory overage fractions %+v, want none", got)
+	}
+	if got := summary.NodeCPUCores[1].Count + summary.NodeCPUCores[2].Count; got != 2 {
+		t.Errorf("got %d nodes with 2 or 4 cores, want 2", got)
+	}
+}
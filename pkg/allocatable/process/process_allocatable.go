@@ -1,107 +1,59 @@
 package main
 
 import (
-	"bufio"
 	"flag"
 	"fmt"
-	"io"
 	"os"
 
-	resourceapi "k8s.io/apimachinery/pkg/api/resource"
-
-	"github.com/dashpole/allocatable/pkg/allocatable/types"
+	"github.com/dashpole/allocatable/pkg/allocatable/analysis"
 	"github.com/dashpole/allocatable/pkg/common"
 )
 
-var path = flag.String("path", "foreachmaster.log", "path to your log file")
+var sourceKind = flag.String("source", common.ForeachMasterSource, "kind of input, one of foreachmaster (a foreachmaster log), dir (a directory with one file of scraper output per cluster), kubectl (a directory of kubectl get -o json dumps), tarball (a tarball of kubectl dumps) or stdin (the scraper output of a single cluster)")
+var path = flag.String("path", "foreachmaster.log", "path to your log file, or directory for the dir and kubectl sources, or tarball")
 var outputFile = flag.String("output", "_output/specificClusterStats.csv", "path to output file")
+var policiesFile = flag.String("policies", "", "path to a YAML or JSON file of reservation policies to compare; if empty, the default policy is used")
+var nodeReportFile = flag.String("node-report", "", "if set, path to write the per-node stats of affected clusters to")
+var nodeReportFormat = flag.String("node-report-format", "csv", "format of the per-node report, either csv or json")
+var project = flag.String("project", "", "if set, only analyze clusters in this project")
+var location = flag.String("location", "", "if set, only analyze clusters in this region or zone")
+var masterVersion = flag.String("master-version", "", "if set, only analyze clusters whose master version starts with this version, e.g. 1.27")
+var summaryGroupBy = flag.String("summary-group-by", "", "if set, group the fleet summary by project, location or version")
+var summaryFile = flag.String("summary", "_output/fleetSummary", "path, without extension, to write the fleet summary to as CSV and JSON; if empty, no summary is written")
+var diagnosticsFile = flag.String("diagnostics", "_output/diagnostics.json", "path to write the problems found in the input to, as JSON; if empty, they are not written")
+var statusReportFile = flag.String("status-report", "_output/clusterStatus.csv", "path to write the status (ok, partial, failed or no-nodes) of every cluster's scrape to; if empty, it is not written")
+var maxFailureRate = flag.Float64("max-failure-rate", common.DefaultMaxFailureRate, "exit with a non-zero status if more than this fraction of clusters could not be analyzed")
+var parallelism = flag.Int("parallelism", 0, "number of clusters to analyze at once; if 0, one per CPU")
 
 func main() {
 	flag.Parse()
-	file, err := os.Open(*path)
+	source, err := common.NewSource(*sourceKind, *path)
 	if err != nil {
-		fmt.Printf("Error opening file: %v", err)
-	}
-	defer file.Close()
-
-	allClusterStats := []types.ClusterStats{}
-	r := bufio.NewReaderSize(file, 512*1024)
-	line, isPrefix, err := r.ReadLine()
-	for err == nil && !isPrefix {
-		clusterAllocated, id := types.ParseClusterAllocated(line)
-		if len(clusterAllocated) > 0 {
-			allClusterStats = append(allClusterStats, getClusterStats(clusterAllocated, id))
-		}
-		line, isPrefix, err = r.ReadLine()
-	}
-	if isPrefix {
-		fmt.Println("buffer size to small")
-		return
-	}
-	if err != io.EOF {
-		fmt.Println(err)
-		return
-	}
-
-	data := [][]string{types.GetClusterStatsHeader()}
-	for _, cluster := range allClusterStats {
-		if cluster.IsAffected() {
-			data = append(data, cluster.ToSlice())
-		}
-	}
-	err = common.ToCSV(*outputFile, data)
+		fmt.Fprintf(os.Stderr, "Error opening input: %v\n", err)
+		os.Exit(common.FatalExitCode)
+	}
+	diagnostics, err := analysis.Run(source, analysis.Options{
+		Output:           *outputFile,
+		PoliciesFile:     *policiesFile,
+		NodeReport:       *nodeReportFile,
+		NodeReportFormat: *nodeReportFormat,
+		Summary:          *summaryFile,
+		SummaryGroupBy:   *summaryGroupBy,
+		Filter: common.ClusterFilter{
+			Project:       *project,
+			Location:      *location,
+			MasterVersion: *masterVersion,
+		},
+		Parallelism:  *parallelism,
+		Diagnostics:  *diagnosticsFile,
+		StatusReport: *statusReportFile,
+	})
 	if err != nil {
-		fmt.Printf("Error writing output to csv: %v\n", err)
-	}
-}
-
-func getClusterStats(c types.ClusterAllocated, id string) types.ClusterStats {
-	totalPerNodeCPUOverage := int64(0)
-	totalPerNodeMemoryOverage := int64(0)
-	totalCPURequests := resourceapi.NewQuantity(0, resourceapi.DecimalSI)
-	totalCPUAllocatable := resourceapi.NewQuantity(0, resourceapi.DecimalSI)
-	totalMemoryRequests := resourceapi.NewQuantity(0, resourceapi.DecimalSI)
-	totalMemoryAllocatable := resourceapi.NewQuantity(0, resourceapi.DecimalSI)
-	totalCPUReserved := resourceapi.NewQuantity(0, resourceapi.DecimalSI)
-	totalMemoryReserved := resourceapi.NewQuantity(0, resourceapi.DecimalSI)
-	for _, na := range c {
-		totalCPURequests.Add(na.CPURequests)
-		totalCPUAllocatable.Add(na.CPUAllocatable)
-		totalMemoryRequests.Add(na.MemoryRequests)
-		totalMemoryAllocatable.Add(na.MemoryAllocatable)
-		cpuReserved := getCPUReservation(na.CPUAllocatable.MilliValue())
-		memoryReserved := getMemoryReservation(na.MemoryAllocatable.Value())
-		totalCPUReserved.Add(cpuReserved)
-		totalMemoryReserved.Add(memoryReserved)
-
-		perNodeCPUOverage := na.CPURequests.MilliValue() + cpuReserved.MilliValue() - na.CPUAllocatable.MilliValue()
-		if perNodeCPUOverage > 0 {
-			totalPerNodeCPUOverage += perNodeCPUOverage
-		}
-
-		perNodeMemoryOverage := na.MemoryRequests.Value() + memoryReserved.Value() - na.MemoryAllocatable.Value()
-		if perNodeMemoryOverage > 0 {
-			totalPerNodeMemoryOverage += perNodeMemoryOverage
-		}
-	}
-	clusterCPUOverage := totalCPURequests.MilliValue() + totalCPUReserved.MilliValue() - totalCPUAllocatable.MilliValue()
-	if clusterCPUOverage < 0 {
-		clusterCPUOverage = 0
-	}
-	clusterMemoryOverage := totalMemoryRequests.Value() + totalMemoryReserved.Value() - totalMemoryAllocatable.Value()
-	if clusterMemoryOverage < 0 {
-		clusterMemoryOverage = 0
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(common.FatalExitCode)
 	}
-	return types.ClusterStats{
-		NumNodes:                  len(c),
-		ClusterCPU:                totalCPUAllocatable.MilliValue(),
-		ClusterMemory:             totalMemoryAllocatable.Value(),
-		ClusterCPUReserved:        totalCPUReserved.MilliValue(),
-		ClusterMemoryReserved:     totalMemoryReserved.Value(),
-		TotalPerNodeCPUOverage:    totalPerNodeCPUOverage,
-		TotalClusterCPUOverage:    clusterCPUOverage,
-		TotalPerNodeMemoryOverage: totalPerNodeMemoryOverage,
-		TotalClusterMemoryOverage: clusterMemoryOverage,
-		Identifier:                id,
+	if diagnostics.ExceedsFailureRate(*maxFailureRate) {
+		fmt.Fprintf(os.Stderr, "Unable to analyze %d of %d clusters, which exceeds the maximum failure rate of %v\n", diagnostics.FailedClusters, diagnostics.Clusters, *maxFailureRate)
+		os.Exit(common.FailureRateExitCode)
 	}
 }
@@ -1,131 +1,90 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"flag"
 	"fmt"
-	"os/exec"
-	"time"
-
-	"k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/resource"
+	"os"
 
 	"github.com/dashpole/allocatable/pkg/allocatable/types"
+	"github.com/dashpole/allocatable/pkg/collector"
+	"github.com/dashpole/allocatable/pkg/common"
 )
 
-const retryNumber = 2
+var masterURL = flag.String("master", "", "address of the kubernetes API server; overrides any value in kubeconfig")
+var kubeconfig = flag.String("kubeconfig", "", "path to a kubeconfig; if empty, the default kubeconfig or in-cluster config is used")
+var includePods = flag.Bool("include-pods", true, "include the requests of each pod in the output, so that evictions can be simulated")
+var outputFormat = flag.String("output-format", "json", "format of the scraped output, either json (one record per line) or legacy")
+var retryPolicy = collector.RegisterRetryFlags()
 
 func main() {
+	flag.Parse()
 	fmt.Printf("Getting Node Allocatable\n")
-	for i := 0; i < retryNumber; i++ {
-		nodeAllocatedList, err := fetchNodeAllocated()
-		if err == nil {
-			if len(nodeAllocatedList) == 0 {
-				fmt.Printf("No Nodes Found\n")
-			}
-			for _, nodeAllocated := range nodeAllocatedList {
-				fmt.Println(nodeAllocated.String())
-			}
-			return
-		}
-		fmt.Printf("Error getting Node Allocatable: %v\n", err)
-		if i < retryNumber-1 {
+	client, err := collector.NewClientset(*masterURL, *kubeconfig)
+	if err != nil {
+		printFailure(collector.NewFailure(err, 1, true))
+		return
+	}
+	c := collector.NewCollector(client)
+	ctx, cancel := retryPolicy.WithBudget(context.Background())
+	defer cancel()
+	var nodeAllocatedList []types.NodeAllocated
+	err = retryPolicy.Retry(ctx, func(ctx context.Context) error {
+		var err error
+		nodeAllocatedList, err = fetchNodeAllocated(ctx, c)
+		return err
+	}, func(err error, attempt int, final bool) {
+		printFailure(collector.NewFailure(err, attempt, final))
+		if !final && *outputFormat == "legacy" {
 			fmt.Printf("Retrying...")
 		}
-		time.Sleep(1 * time.Minute)
-	}
-}
-
-func fetchNodeAllocated() ([]types.NodeAllocated, error) {
-	podsBlob, err := exec.Command("kubectl", "get", "pods", "--all-namespaces=true", "-o", "json").CombinedOutput()
+	})
 	if err != nil {
-		return nil, fmt.Errorf("Error getting pods: %v\n", err)
+		return
 	}
-	var podList v1.PodList
-	json.Unmarshal(podsBlob, &podList)
-
-	nodesBlob, err := exec.Command("kubectl", "get", "nodes", "-o", "json").CombinedOutput()
-	if err != nil {
-		return nil, fmt.Errorf("Error getting nodes: %v\n", err)
+	if len(nodeAllocatedList) == 0 {
+		fmt.Println(types.NoNodesFound)
+	}
+	for _, nodeAllocated := range nodeAllocatedList {
+		printNodeAllocated(nodeAllocated)
 	}
-	var nodeList v1.NodeList
-	json.Unmarshal(nodesBlob, &nodeList)
+}
 
-	nodeAllocatedList, err := getNodeAllocatedList(podList.Items, nodeList.Items)
+func printNodeAllocated(nodeAllocated types.NodeAllocated) {
+	if *outputFormat == "legacy" {
+		fmt.Println(nodeAllocated.String())
+		return
+	}
+	record, err := nodeAllocated.ToRecord()
 	if err != nil {
-		return nil, fmt.Errorf("Error calculating node allocated: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error getting Node Allocatable: %v\n", err)
+		return
 	}
-	return nodeAllocatedList, nil
+	fmt.Println(record)
 }
 
-func getNodeAllocatedList(pods []v1.Pod, nodes []v1.Node) ([]types.NodeAllocated, error) {
-	nodeAllocatedList := []types.NodeAllocated{}
-	for _, node := range nodes {
-		memoryRequests := resource.NewQuantity(0, resource.DecimalSI)
-		cpuRequests := resource.NewQuantity(0, resource.DecimalSI)
-		for _, pod := range pods {
-			if pod.Spec.NodeName != node.Name {
-				//skip if the pod is not on the current node
-				continue
-			}
-			req, _ := PodRequestsAndLimits(&pod)
-			memoryRequests.Add(req[v1.ResourceMemory])
-			cpuRequests.Add(req[v1.ResourceCPU])
+// printFailure prints a failure record, or an error in the legacy format.
+func printFailure(failure common.Failure) {
+	if *outputFormat != "legacy" {
+		record, err := failure.ToRecord()
+		if err == nil {
+			fmt.Println(record)
+			return
 		}
-		nodeAllocatedList = append(nodeAllocatedList, types.NodeAllocated{
-			NodeName:          node.Name,
-			MemoryAllocatable: node.Status.Allocatable[v1.ResourceMemory],
-			CPUAllocatable:    node.Status.Allocatable[v1.ResourceCPU],
-			MemoryRequests:    *memoryRequests,
-			CPURequests:       *cpuRequests,
-		})
 	}
-	return nodeAllocatedList, nil
+	fmt.Fprintf(os.Stderr, "Error getting Node Allocatable: %v\n", failure.Error)
 }
 
-// PodRequestsAndLimits returns a dictionary of all defined resources summed up for all
-// containers of the pod.
-func PodRequestsAndLimits(pod *v1.Pod) (reqs map[v1.ResourceName]resource.Quantity, limits map[v1.ResourceName]resource.Quantity) {
-	reqs, limits = map[v1.ResourceName]resource.Quantity{}, map[v1.ResourceName]resource.Quantity{}
-	for _, container := range pod.Spec.Containers {
-		for name, quantity := range container.Resources.Requests {
-			if value, ok := reqs[name]; !ok {
-				reqs[name] = *quantity.Copy()
-			} else {
-				value.Add(quantity)
-				reqs[name] = value
-			}
-		}
-		for name, quantity := range container.Resources.Limits {
-			if value, ok := limits[name]; !ok {
-				limits[name] = *quantity.Copy()
-			} else {
-				value.Add(quantity)
-				limits[name] = value
-			}
-		}
+func fetchNodeAllocated(ctx context.Context, c *collector.Collector) ([]types.NodeAllocated, error) {
+	pods, err := c.ListPods(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting pods: %w", err)
 	}
-	// init containers define the minimum of any resource
-	for _, container := range pod.Spec.InitContainers {
-		for name, quantity := range container.Resources.Requests {
-			value, ok := reqs[name]
-			if !ok {
-				reqs[name] = *quantity.Copy()
-				continue
-			}
-			if quantity.Cmp(value) > 0 {
-				reqs[name] = *quantity.Copy()
-			}
-		}
-		for name, quantity := range container.Resources.Limits {
-			value, ok := limits[name]
-			if !ok {
-				limits[name] = *quantity.Copy()
-				continue
-			}
-			if quantity.Cmp(value) > 0 {
-				limits[name] = *quantity.Copy()
-			}
-		}
+
+	nodes, err := c.ListNodes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting nodes: %w", err)
 	}
-	return
+
+	return types.GetNodeAllocatedList(pods, nodes, *includePods), nil
 }
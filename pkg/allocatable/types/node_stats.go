@@ -0,0 +1,70 @@
+package types
+
+import (
+	"fmt"
+	"strconv"
+
+	"k8s.io/api/core/v1"
+
+	"github.com/dashpole/allocatable/pkg/common"
+)
+
+// NodeResourceStats is the impact of a reservation policy on one resource of
+// a node.  Values are in millicores for CPU, and in the base unit of all other
+// resources.
+type NodeResourceStats struct {
+	Capacity    int64 `json:"capacity"`
+	Allocatable int64 `json:"allocatable"`
+	// Reserved is the amount the policy reserves beyond what the node already
+	// reserves.  It is negative if the policy reserves less than the node does.
+	Reserved int64 `json:"reserved"`
+	Proposed int64 `json:"proposedAllocatable"`
+	Requests int64 `json:"requests"`
+	Limits   int64 `json:"limits"`
+	// Overage is the amount by which requests exceed the proposed allocatable.
+	Overage int64 `json:"overage"`
+}
+
+// NodeStats is the impact of a reservation policy on a single node.
+type NodeStats struct {
+	Identifier common.ClusterIdentifier              `json:"identifier"`
+	Policy     string                                `json:"policy"`
+	NodeName   string                                `json:"nodeName"`
+	Resources  map[v1.ResourceName]NodeResourceStats `json:"resources"`
+	// Fits is false if the pods scheduled to the node would not fit within
+	// the proposed allocatable.
+	Fits bool `json:"fits"`
+	// EvictedPods is the number of pods which would be evicted from the node
+	// in order to fit within the proposed allocatable.
+	EvictedPods int `json:"evictedPods"`
+}
+
+// ToSlice returns the stats as a CSV row, with columns for the given resources.
+func (n NodeStats) ToSlice(resources []v1.ResourceName) []string {
+	row := append(n.Identifier.ToSlice(), n.Policy, n.NodeName, strconv.FormatBool(n.Fits), strconv.Itoa(n.EvictedPods))
+	for _, name := range resources {
+		r := n.Resources[name]
+		for _, value := range []int64{r.Capacity, r.Allocatable, r.Reserved, r.Proposed, r.Requests, r.Overage} {
+			row = append(row, strconv.FormatInt(value, 10))
+		}
+	}
+	return row
+}
+
+// GetNodeStatsHeader returns the CSV header for NodeStats.ToSlice.
+func GetNodeStatsHeader(resources []v1.ResourceName) []string {
+	header := append(common.GetClusterIdentifierHeader(), "Policy", "Node", "Fits", "Evicted Pods")
+	for _, name := range resources {
+		for _, template := range []string{
+			"%s Capacity",
+			"%s Allocatable",
+			"%s Reserved",
+			"%s Proposed Allocatable",
+			"%s Requests",
+			"%s Overage",
+		} {
+			header = append(header, fmt.Sprintf(template, resourceDisplayName(name)))
+		}
+	}
+	return header
+}
@@ -0,0 +1,46 @@
+package types
+
+import (
+	"k8s.io/api/core/v1"
+)
+
+var qosResources = []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory}
+
+// getPodQOS returns the QoS class of the pod.  The API server sets the class
+// in the pod status, but older servers do not, so it is computed from the
+// container resources the same way the kubelet does if it is missing.
+func getPodQOS(pod *v1.Pod) v1.PodQOSClass {
+	if pod.Status.QOSClass != "" {
+		return pod.Status.QOSClass
+	}
+	requests := map[v1.ResourceName]bool{}
+	limits := map[v1.ResourceName]bool{}
+	isGuaranteed := true
+	containers := append(append([]v1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, container := range containers {
+		for _, name := range qosResources {
+			request, hasRequest := container.Resources.Requests[name]
+			limit, hasLimit := container.Resources.Limits[name]
+			if hasRequest && !request.IsZero() {
+				requests[name] = true
+			}
+			if hasLimit && !limit.IsZero() {
+				limits[name] = true
+			} else {
+				isGuaranteed = false
+			}
+			// requests default to limits, so an unset request does not
+			// prevent the pod from being guaranteed
+			if hasRequest && hasLimit && request.Cmp(limit) != 0 {
+				isGuaranteed = false
+			}
+		}
+	}
+	if len(requests) == 0 && len(limits) == 0 {
+		return v1.PodQOSBestEffort
+	}
+	if isGuaranteed {
+		return v1.PodQOSGuaranteed
+	}
+	return v1.PodQOSBurstable
+}
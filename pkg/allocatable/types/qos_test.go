@@ -0,0 +1,143 @@
+package types
+
+import (
+	"testing"
+
+	"k8s.io/api/core/v1"
+	resourceapi "k8s.io/apimachinery/pkg/api/resource"
+)
+
+// resources returns a resource list with the cpu and memory quantities which
+// are set.
+func resources(cpu, memory string) v1.ResourceList {
+	list := v1.ResourceList{}
+	if cpu != "" {
+		list[v1.ResourceCPU] = resourceapi.MustParse(cpu)
+	}
+	if memory != "" {
+		list[v1.ResourceMemory] = resourceapi.MustParse(memory)
+	}
+	return list
+}
+
+func qosContainer(requests, limits v1.ResourceList) v1.Container {
+	return v1.Container{Resources: v1.ResourceRequirements{Requests: requests, Limits: limits}}
+}
+
+func qosSidecar(requests, limits v1.ResourceList) v1.Container {
+	c := qosContainer(requests, limits)
+	always := v1.ContainerRestartPolicyAlways
+	c.RestartPolicy = &always
+	return c
+}
+
+func TestGetPodQOS(t *testing.T) {
+	guaranteed := qosContainer(resources("1", "1Gi"), resources("1", "1Gi"))
+	bestEffort := qosContainer(nil, nil)
+	testCases := []struct {
+		name string
+		pod  v1.Pod
+		want v1.PodQOSClass
+	}{
+		{
+			name: "status takes precedence",
+			pod:  v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{bestEffort}}, Status: v1.PodStatus{QOSClass: v1.PodQOSBurstable}},
+			want: v1.PodQOSBurstable,
+		},
+		{
+			name: "no resources",
+			pod:  v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{bestEffort, bestEffort}}},
+			want: v1.PodQOSBestEffort,
+		},
+		{
+			name: "zero requests",
+			pod:  v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{qosContainer(resources("0", "0"), nil)}}},
+			want: v1.PodQOSBestEffort,
+		},
+		{
+			name: "only other resources",
+			pod: v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{qosContainer(
+				v1.ResourceList{v1.ResourceEphemeralStorage: resourceapi.MustParse("1Gi")},
+				v1.ResourceList{v1.ResourceEphemeralStorage: resourceapi.MustParse("1Gi")},
+			)}}},
+			want: v1.PodQOSBestEffort,
+		},
+		{
+			name: "requests equal limits",
+			pod:  v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{guaranteed, guaranteed}}},
+			want: v1.PodQOSGuaranteed,
+		},
+		{
+			name: "limits only",
+			pod:  v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{qosContainer(nil, resources("1", "1Gi"))}}},
+			want: v1.PodQOSGuaranteed,
+		},
+		{
+			name: "partial requests default to limits",
+			pod:  v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{qosContainer(resources("1", ""), resources("1", "1Gi"))}}},
+			want: v1.PodQOSGuaranteed,
+		},
+		{
+			name: "cpu limit only",
+			pod:  v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{qosContainer(nil, resources("1", ""))}}},
+			want: v1.PodQOSBurstable,
+		},
+		{
+			name: "requests only",
+			pod:  v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{qosContainer(resources("1", "1Gi"), nil)}}},
+			want: v1.PodQOSBurstable,
+		},
+		{
+			name: "requests below limits",
+			pod:  v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{qosContainer(resources("500m", "1Gi"), resources("1", "1Gi"))}}},
+			want: v1.PodQOSBurstable,
+		},
+		{
+			name: "one best effort container",
+			pod:  v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{guaranteed, bestEffort}}},
+			want: v1.PodQOSBurstable,
+		},
+		{
+			name: "guaranteed init container",
+			pod:  v1.Pod{Spec: v1.PodSpec{InitContainers: []v1.Container{guaranteed}, Containers: []v1.Container{guaranteed}}},
+			want: v1.PodQOSGuaranteed,
+		},
+		{
+			name: "best effort init container",
+			pod:  v1.Pod{Spec: v1.PodSpec{InitContainers: []v1.Container{bestEffort}, Containers: []v1.Container{guaranteed}}},
+			want: v1.PodQOSBurstable,
+		},
+		{
+			name: "burstable init container",
+			pod:  v1.Pod{Spec: v1.PodSpec{InitContainers: []v1.Container{qosContainer(resources("100m", ""), nil)}, Containers: []v1.Container{bestEffort}}},
+			want: v1.PodQOSBurstable,
+		},
+		{
+			name: "limits only init container",
+			pod:  v1.Pod{Spec: v1.PodSpec{InitContainers: []v1.Container{qosContainer(nil, resources("1", "1Gi"))}, Containers: []v1.Container{guaranteed}}},
+			want: v1.PodQOSGuaranteed,
+		},
+		{
+			name: "guaranteed sidecar",
+			pod:  v1.Pod{Spec: v1.PodSpec{InitContainers: []v1.Container{qosSidecar(resources("100m", "64Mi"), resources("100m", "64Mi"))}, Containers: []v1.Container{guaranteed}}},
+			want: v1.PodQOSGuaranteed,
+		},
+		{
+			name: "burstable sidecar",
+			pod:  v1.Pod{Spec: v1.PodSpec{InitContainers: []v1.Container{qosSidecar(resources("100m", "64Mi"), resources("200m", "64Mi"))}, Containers: []v1.Container{guaranteed}}},
+			want: v1.PodQOSBurstable,
+		},
+		{
+			name: "best effort sidecar",
+			pod:  v1.Pod{Spec: v1.PodSpec{InitContainers: []v1.Container{qosSidecar(nil, nil)}, Containers: []v1.Container{bestEffort}}},
+			want: v1.PodQOSBestEffort,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := getPodQOS(&tc.pod); got != tc.want {
+				t.Errorf("getPodQOS() = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
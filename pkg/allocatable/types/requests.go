@@ -0,0 +1,131 @@
+package types
+
+import (
+	"k8s.io/api/core/v1"
+	resourceapi "k8s.io/apimachinery/pkg/api/resource"
+)
+
+// GetNodeAllocatedList returns the requests and limits of the pods scheduled
+// to each node.  If includePods is true, the requests of each pod are
+// included as well, so that evictions can be simulated.
+func GetNodeAllocatedList(pods []v1.Pod, nodes []v1.Node, includePods bool) ClusterAllocated {
+	nodeAllocatedList := ClusterAllocated{}
+	for _, node := range nodes {
+		requests := v1.ResourceList{}
+		limits := v1.ResourceList{}
+		podsByQOSClass := map[v1.PodQOSClass]int{}
+		podsAllocated := []PodAllocated{}
+		numPods := int64(0)
+		for _, pod := range pods {
+			if pod.Spec.NodeName != node.Name {
+				//skip if the pod is not on the current node
+				continue
+			}
+			if isTerminal(&pod) {
+				continue
+			}
+			numPods++
+			qosClass := getPodQOS(&pod)
+			podsByQOSClass[qosClass]++
+			req, lim := PodRequestsAndLimits(&pod)
+			addResourceList(requests, req)
+			addResourceList(limits, lim)
+			if includePods {
+				podAllocated := PodAllocated{
+					Name:      pod.Name,
+					Namespace: pod.Namespace,
+					QOSClass:  qosClass,
+					Requests:  req,
+				}
+				if pod.Spec.Priority != nil {
+					podAllocated.Priority = *pod.Spec.Priority
+				}
+				podsAllocated = append(podsAllocated, podAllocated)
+			}
+		}
+		// each pod uses one of the node's allocatable pods
+		requests[v1.ResourcePods] = *resourceapi.NewQuantity(numPods, resourceapi.DecimalSI)
+		nodeAllocatedList = append(nodeAllocatedList, NodeAllocated{
+			NodeName:       node.Name,
+			Capacity:       node.Status.Capacity,
+			Allocatable:    node.Status.Allocatable,
+			Requests:       requests,
+			Limits:         limits,
+			PodsByQOSClass: podsByQOSClass,
+			Pods:           podsAllocated,
+		})
+	}
+	return nodeAllocatedList
+}
+
+// addResourceList adds each quantity in b to the matching quantity in a.
+func addResourceList(a, b v1.ResourceList) {
+	for name, quantity := range b {
+		value := a[name]
+		value.Add(quantity)
+		a[name] = value
+	}
+}
+
+// PodRequestsAndLimits returns the effective requests and limits of the pod,
+// computed the same way as the scheduler: the sum of the containers and
+// restartable (sidecar) init containers, or the largest regular init container
+// plus the sidecars started before it if that is larger, plus pod overhead.
+func PodRequestsAndLimits(pod *v1.Pod) (reqs v1.ResourceList, limits v1.ResourceList) {
+	reqs = podResources(pod, func(container v1.Container) v1.ResourceList { return container.Resources.Requests })
+	addResourceList(reqs, pod.Spec.Overhead)
+
+	limits = podResources(pod, func(container v1.Container) v1.ResourceList { return container.Resources.Limits })
+	// overhead only counts toward limits which are set, as an unset limit is unbounded
+	for name, quantity := range pod.Spec.Overhead {
+		if value, ok := limits[name]; ok {
+			value.Add(quantity)
+			limits[name] = value
+		}
+	}
+	return
+}
+
+func podResources(pod *v1.Pod, containerResources func(v1.Container) v1.ResourceList) v1.ResourceList {
+	total := v1.ResourceList{}
+	for _, container := range pod.Spec.Containers {
+		addResourceList(total, containerResources(container))
+	}
+	// init containers run sequentially, so only the largest one counts, but
+	// restartable init containers keep running once started
+	restartable := v1.ResourceList{}
+	initMax := v1.ResourceList{}
+	for _, container := range pod.Spec.InitContainers {
+		running := v1.ResourceList{}
+		addResourceList(running, containerResources(container))
+		if isRestartableInitContainer(container) {
+			addResourceList(total, running)
+			addResourceList(restartable, running)
+			running = restartable
+		} else {
+			addResourceList(running, restartable)
+		}
+		maxResourceList(initMax, running)
+	}
+	maxResourceList(total, initMax)
+	return total
+}
+
+func isRestartableInitContainer(container v1.Container) bool {
+	return container.RestartPolicy != nil && *container.RestartPolicy == v1.ContainerRestartPolicyAlways
+}
+
+// maxResourceList sets each quantity in a to the larger of it and the matching quantity in b.
+func maxResourceList(a, b v1.ResourceList) {
+	for name, quantity := range b {
+		if value, ok := a[name]; !ok || quantity.Cmp(value) > 0 {
+			a[name] = quantity.DeepCopy()
+		}
+	}
+}
+
+// isTerminal returns true if the pod has finished, and no longer consumes
+// resources on its node.
+func isTerminal(pod *v1.Pod) bool {
+	return pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed
+}
@@ -0,0 +1,161 @@
+package types
+
+import (
+	"testing"
+
+	"k8s.io/api/core/v1"
+	resourceapi "k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func container(cpuRequest, cpuLimit string) v1.Container {
+	c := v1.Container{Resources: v1.ResourceRequirements{Requests: v1.ResourceList{}, Limits: v1.ResourceList{}}}
+	if cpuRequest != "" {
+		c.Resources.Requests[v1.ResourceCPU] = resourceapi.MustParse(cpuRequest)
+	}
+	if cpuLimit != "" {
+		c.Resources.Limits[v1.ResourceCPU] = resourceapi.MustParse(cpuLimit)
+	}
+	return c
+}
+
+func sidecar(cpuRequest, cpuLimit string) v1.Container {
+	c := container(cpuRequest, cpuLimit)
+	always := v1.ContainerRestartPolicyAlways
+	c.RestartPolicy = &always
+	return c
+}
+
+func TestPodRequestsAndLimits(t *testing.T) {
+	testCases := []struct {
+		name         string
+		spec         v1.PodSpec
+		wantRequests v1.ResourceList
+		wantLimits   v1.ResourceList
+	}{
+		{
+			name:         "containers are summed",
+			spec:         v1.PodSpec{Containers: []v1.Container{container("100m", "200m"), container("200m", "")}},
+			wantRequests: v1.ResourceList{v1.ResourceCPU: resourceapi.MustParse("300m")},
+			wantLimits:   v1.ResourceList{v1.ResourceCPU: resourceapi.MustParse("200m")},
+		},
+		{
+			name: "largest regular init container",
+			spec: v1.PodSpec{
+				InitContainers: []v1.Container{container("1", "2"), container("500m", "")},
+				Containers:     []v1.Container{container("300m", "300m")},
+			},
+			wantRequests: v1.ResourceList{v1.ResourceCPU: resourceapi.MustParse("1")},
+			wantLimits:   v1.ResourceList{v1.ResourceCPU: resourceapi.MustParse("2")},
+		},
+		{
+			name: "regular init container smaller than containers",
+			spec: v1.PodSpec{
+				InitContainers: []v1.Container{container("100m", "")},
+				Containers:     []v1.Container{container("300m", "")},
+			},
+			wantRequests: v1.ResourceList{v1.ResourceCPU: resourceapi.MustParse("300m")},
+			wantLimits:   v1.ResourceList{},
+		},
+		{
+			name: "sidecars run alongside the containers",
+			spec: v1.PodSpec{
+				InitContainers: []v1.Container{sidecar("100m", "100m")},
+				Containers:     []v1.Container{container("300m", "300m")},
+			},
+			wantRequests: v1.ResourceList{v1.ResourceCPU: resourceapi.MustParse("400m")},
+			wantLimits:   v1.ResourceList{v1.ResourceCPU: resourceapi.MustParse("400m")},
+		},
+		{
+			name: "regular init container after a sidecar runs alongside it",
+			spec: v1.PodSpec{
+				InitContainers: []v1.Container{sidecar("200m", ""), container("500m", "")},
+				Containers:     []v1.Container{container("300m", "")},
+			},
+			wantRequests: v1.ResourceList{v1.ResourceCPU: resourceapi.MustParse("700m")},
+			wantLimits:   v1.ResourceList{},
+		},
+		{
+			name: "regular init container before a sidecar runs alone",
+			spec: v1.PodSpec{
+				InitContainers: []v1.Container{container("500m", ""), sidecar("200m", "")},
+				Containers:     []v1.Container{container("300m", "")},
+			},
+			wantRequests: v1.ResourceList{v1.ResourceCPU: resourceapi.MustParse("500m")},
+			wantLimits:   v1.ResourceList{},
+		},
+		{
+			name: "overhead is added to requests and set limits",
+			spec: v1.PodSpec{
+				Containers: []v1.Container{container("100m", "200m")},
+				Overhead: v1.ResourceList{
+					v1.ResourceCPU:    resourceapi.MustParse("50m"),
+					v1.ResourceMemory: resourceapi.MustParse("10Mi"),
+				},
+			},
+			wantRequests: v1.ResourceList{
+				v1.ResourceCPU:    resourceapi.MustParse("150m"),
+				v1.ResourceMemory: resourceapi.MustParse("10Mi"),
+			},
+			wantLimits: v1.ResourceList{v1.ResourceCPU: resourceapi.MustParse("250m")},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			requests, limits := PodRequestsAndLimits(&v1.Pod{Spec: tc.spec})
+			expectResourceList(t, "requests", requests, tc.wantRequests)
+			expectResourceList(t, "limits", limits, tc.wantLimits)
+		})
+	}
+}
+
+func expectResourceList(t *testing.T, what string, got, want v1.ResourceList) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("got %s %v, want %v", what, got, want)
+		return
+	}
+	for name, quantity := range want {
+		if value, ok := got[name]; !ok || value.Cmp(quantity) != 0 {
+			t.Errorf("got %s %v, want %v", what, got, want)
+			return
+		}
+	}
+}
+
+func TestTerminalPodsExcluded(t *testing.T) {
+	testCases := []struct {
+		phase        v1.PodPhase
+		wantTerminal bool
+	}{
+		{phase: v1.PodPending, wantTerminal: false},
+		{phase: v1.PodRunning, wantTerminal: false},
+		{phase: v1.PodSucceeded, wantTerminal: true},
+		{phase: v1.PodFailed, wantTerminal: true},
+	}
+	for _, tc := range testCases {
+		t.Run(string(tc.phase), func(t *testing.T) {
+			pod := v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "pod"},
+				Spec:       v1.PodSpec{NodeName: "node", Containers: []v1.Container{container("100m", "")}},
+				Status:     v1.PodStatus{Phase: tc.phase},
+			}
+			if got := isTerminal(&pod); got != tc.wantTerminal {
+				t.Errorf("isTerminal() = %v, want %v", got, tc.wantTerminal)
+			}
+			nodes := []v1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "node"}}}
+			allocated := GetNodeAllocatedList([]v1.Pod{pod}, nodes, true)
+			wantPods := 1
+			if tc.wantTerminal {
+				wantPods = 0
+			}
+			if len(allocated) != 1 || len(allocated[0].Pods) != wantPods {
+				t.Fatalf("GetNodeAllocatedList() = %+v, want 1 node with %d pods", allocated, wantPods)
+			}
+			cpu := allocated[0].Requests[v1.ResourceCPU]
+			if cpu.MilliValue() != int64(100*wantPods) {
+				t.Errorf("got %dm cpu requested, want %dm", cpu.MilliValue(), 100*wantPods)
+			}
+		})
+	}
+}
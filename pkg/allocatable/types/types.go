@@ -3,118 +3,372 @@ package types
 import (
 	"fmt"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 
+	"k8s.io/api/core/v1"
 	resourceapi "k8s.io/apimachinery/pkg/api/resource"
 
 	"github.com/dashpole/allocatable/pkg/common"
 )
 
+// ResourceStats are the cluster wide stats for a single resource.  Values
+// are in millicores for CPU, and in the base unit of all other resources.
+type ResourceStats struct {
+	// Capacity is the total node capacity, or allocatable for nodes whose
+	// scraper output has no capacity.
+	Capacity            int64
+	Allocatable         int64
+	Reserved            int64
+	Proposed            int64
+	TotalPerNodeOverage int64
+	TotalClusterOverage int64
+	Limits              int64
+	// MaxNodeOvercommit is the highest ratio of limits to allocatable of
+	// any node in the cluster.
+	MaxNodeOvercommit float64
+	// OvercommittedNodes is the number of nodes whose limits exceed allocatable.
+	OvercommittedNodes int
+}
+
 type ClusterStats struct {
-	NumNodes                  int
-	ClusterCPU                int64
-	ClusterMemory             int64
-	ClusterCPUReserved        int64
-	ClusterMemoryReserved     int64
-	TotalPerNodeCPUOverage    int64
-	TotalClusterCPUOverage    int64
-	TotalPerNodeMemoryOverage int64
-	TotalClusterMemoryOverage int64
-	Identifier                string
-}
-
-func (c ClusterStats) ToSlice() []string {
-	return []string{
-		strconv.Itoa(int(c.NumNodes)),
-		strconv.Itoa(int(c.ClusterCPU)),
-		strconv.Itoa(int(c.ClusterMemory)),
-		strconv.Itoa(int(c.ClusterCPUReserved)),
-		strconv.Itoa(int(c.ClusterMemoryReserved)),
-		strconv.Itoa(int(c.TotalPerNodeCPUOverage)),
-		strconv.Itoa(int(c.TotalPerNodeMemoryOverage)),
-		strconv.Itoa(int(c.TotalClusterCPUOverage)),
-		strconv.Itoa(int(c.TotalClusterMemoryOverage)),
-		c.Identifier,
-	}
-}
-
-func GetClusterStatsHeader() []string {
-	return []string{
-		"Nodes",
-		"CPU Capacity",
-		"Memory Capacity",
-		"CPU Reserved",
-		"Memory Reserved",
-		"Node CPU Overage",
-		"Node Memory Overage",
-		"Cluster CPU Overage",
-		"Cluster Memory Overage",
-		"Identifier",
+	NumNodes       int
+	Resources      map[v1.ResourceName]ResourceStats
+	PodsByQOSClass map[v1.PodQOSClass]int
+	// Simulated is true if the scraper output included pods, so evictions
+	// and rescheduling could be simulated.
+	Simulated bool
+	// DisplacedPods is the number of pods evicted from nodes which could not
+	// fit them under the proposed allocatable.
+	DisplacedPods int
+	// UnschedulablePods is the number of displaced pods which did not fit on
+	// any other node.
+	UnschedulablePods int
+	Identifier        common.ClusterIdentifier
+	Policy            string
+	// Status is the status of the cluster's scrape, either ok or partial.
+	Status string
+}
+
+var qosClasses = []v1.PodQOSClass{v1.PodQOSGuaranteed, v1.PodQOSBurstable, v1.PodQOSBestEffort}
+
+// ToSlice returns the stats as a CSV row, with columns for the given resources.
+func (c ClusterStats) ToSlice(resources []v1.ResourceName) []string {
+	row := []string{strconv.Itoa(int(c.NumNodes))}
+	for _, field := range []func(ResourceStats) int64{
+		func(r ResourceStats) int64 { return r.Allocatable },
+		func(r ResourceStats) int64 { return r.Reserved },
+		func(r ResourceStats) int64 { return r.Proposed },
+		func(r ResourceStats) int64 { return r.TotalPerNodeOverage },
+		func(r ResourceStats) int64 { return r.TotalClusterOverage },
+		func(r ResourceStats) int64 { return r.Limits },
+	} {
+		for _, name := range resources {
+			row = append(row, strconv.FormatInt(field(c.Resources[name]), 10))
+		}
+	}
+	for _, name := range resources {
+		row = append(row, strconv.FormatFloat(c.Resources[name].MaxNodeOvercommit, 'f', 2, 64))
+	}
+	for _, name := range resources {
+		row = append(row, strconv.Itoa(c.Resources[name].OvercommittedNodes))
+	}
+	for _, class := range qosClasses {
+		row = append(row, strconv.Itoa(c.PodsByQOSClass[class]))
+	}
+	row = append(row, strconv.FormatBool(c.Simulated), strconv.Itoa(c.DisplacedPods), strconv.Itoa(c.UnschedulablePods))
+	row = append(row, c.Identifier.ToSlice()...)
+	return append(row, c.Policy, c.Status)
+}
+
+// GetClusterStatsHeader returns the CSV header for ClusterStats.ToSlice.
+func GetClusterStatsHeader(resources []v1.ResourceName) []string {
+	header := []string{"Nodes"}
+	for _, template := range []string{
+		"%s Capacity",
+		"%s Reserved",
+		"%s Proposed Allocatable",
+		"Node %s Overage",
+		"Cluster %s Overage",
+		"%s Limits",
+		"Max Node %s Overcommit",
+		"Overcommitted %s Nodes",
+	} {
+		for _, name := range resources {
+			header = append(header, fmt.Sprintf(template, resourceDisplayName(name)))
+		}
+	}
+	for _, class := range qosClasses {
+		header = append(header, fmt.Sprintf("%s Pods", class))
+	}
+	header = append(header, "Simulated", "Displaced Pods", "Unschedulable Pods")
+	header = append(header, common.GetClusterIdentifierHeader()...)
+	return append(header, "Policy", "Status")
+}
+
+func resourceDisplayName(name v1.ResourceName) string {
+	switch name {
+	case v1.ResourceCPU:
+		return "CPU"
+	case v1.ResourceMemory:
+		return "Memory"
+	case v1.ResourceEphemeralStorage:
+		return "Ephemeral Storage"
+	case "":
+		return ""
 	}
+	// capitalize the first letter of other resources, e.g. pods becomes Pods
+	return strings.ToUpper(string(name[:1])) + string(name[1:])
 }
 
+// GetResourceNames returns the resources tracked by any of the stats, with
+// CPU and memory first, and the rest sorted by name.
+func GetResourceNames(stats []ClusterStats) []v1.ResourceName {
+	others := map[v1.ResourceName]bool{}
+	for _, c := range stats {
+		for name := range c.Resources {
+			if name != v1.ResourceCPU && name != v1.ResourceMemory {
+				others[name] = true
+			}
+		}
+	}
+	names := []v1.ResourceName{}
+	for name := range others {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return append([]v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory}, names...)
+}
+
+// IsAffected returns true if the policy would leave pods in the cluster
+// unschedulable.  If evictions could not be simulated, a cluster is affected
+// if its requests fit within allocatable, but not the proposed allocatable.
 func (c ClusterStats) IsAffected() bool {
-	if c.TotalClusterCPUOverage > 0 && c.TotalClusterCPUOverage < c.ClusterCPUReserved {
-		// affected by CPU
-		return true
-	} else if c.TotalClusterMemoryOverage > 0 && c.TotalClusterMemoryOverage < c.ClusterMemoryReserved {
-		return true
+	if c.Simulated {
+		return c.UnschedulablePods > 0
+	}
+	for _, r := range c.Resources {
+		if r.TotalClusterOverage > 0 && r.TotalClusterOverage < r.Reserved {
+			return true
+		}
 	}
 	return false
 }
 
+// QuantityValue returns the value of a quantity of the resource, in
+// millicores for CPU, and in the base unit of all other resources.
+func QuantityValue(name v1.ResourceName, q resourceapi.Quantity) int64 {
+	if name == v1.ResourceCPU {
+		return q.MilliValue()
+	}
+	return q.Value()
+}
+
 type ClusterAllocated []NodeAllocated
 
-func ParseClusterAllocated(input []byte) (ClusterAllocated, string) {
+// NoNodesFound is printed by the scraper if the cluster has no nodes.
+const NoNodesFound = "No Nodes Found"
+
+// HasNoNodesFound returns true if the scraper output reports that the cluster
+// has no nodes.
+func HasNoNodesFound(lines []string) bool {
+	for _, line := range lines {
+		if strings.TrimSpace(line) == NoNodesFound {
+			return true
+		}
+	}
+	return false
+}
+
+// GetClusterAllocated returns the nodes of a cluster, computed from its
+// snapshot if it has one, or parsed from the scraper output otherwise.
+func GetClusterAllocated(output common.ClusterOutput) (ClusterAllocated, error) {
+	if output.Snapshot != nil {
+		return GetNodeAllocatedList(output.Snapshot.Pods, output.Snapshot.Nodes, true), nil
+	}
+	return ParseClusterAllocated(output.Lines)
+}
+
+// ParseClusterAllocated parses the allocatable scraper output for a single
+// cluster.  It returns an error if any node record can not be parsed.
+func ParseClusterAllocated(lines []string) (ClusterAllocated, error) {
 	clusterAllocated := []NodeAllocated{}
-	id, lines, err := common.ParseForeachMasterLine(input)
-	if err == nil {
-		for _, node := range lines {
-			nodeAllocated := parseNodeAllocated(node)
-			if nodeAllocated != nil {
-				clusterAllocated = append(clusterAllocated, *nodeAllocated)
-			}
+	for _, node := range lines {
+		var nodeAllocated *NodeAllocated
+		var err error
+		if common.IsRecord(node) {
+			nodeAllocated, err = parseNodeAllocatedRecord(node)
+		} else {
+			// fall back to the legacy output format
+			nodeAllocated, err = parseNodeAllocated(node)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if nodeAllocated != nil {
+			clusterAllocated = append(clusterAllocated, *nodeAllocated)
 		}
 	}
-	return clusterAllocated, id
+	return clusterAllocated, nil
 }
 
+// NodeAllocated holds the capacity, allocatable and pod requests and limits
+// of a node, for every resource the node or its pods reference.  Extended
+// resources, such as nvidia.com/gpu, are treated as plain counters.
 type NodeAllocated struct {
-	NodeName          string
-	MemoryAllocatable resourceapi.Quantity
-	CPUAllocatable    resourceapi.Quantity
-	MemoryRequests    resourceapi.Quantity
-	CPURequests       resourceapi.Quantity
+	NodeName       string                 `json:"nodeName"`
+	Capacity       v1.ResourceList        `json:"capacity"`
+	Allocatable    v1.ResourceList        `json:"allocatable"`
+	Requests       v1.ResourceList        `json:"requests"`
+	Limits         v1.ResourceList        `json:"limits,omitempty"`
+	PodsByQOSClass map[v1.PodQOSClass]int `json:"podsByQOSClass,omitempty"`
+	Pods           []PodAllocated         `json:"pods,omitempty"`
 }
 
-const NodeExpr = `^NodeName: (.*), Memory: (.*) / (.*) = .*, CPU: (.*) / (.*) = .*$`
+// PodAllocated holds the fields of a pod which are needed to simulate
+// evicting it, and scheduling it on another node.
+type PodAllocated struct {
+	Name      string          `json:"name"`
+	Namespace string          `json:"namespace"`
+	Priority  int32           `json:"priority,omitempty"`
+	QOSClass  v1.PodQOSClass  `json:"qosClass"`
+	Requests  v1.ResourceList `json:"requests,omitempty"`
+}
+
+// nodeAllocatedV1 is the node record data written by version 1 scrapers.
+type nodeAllocatedV1 struct {
+	NodeName          string               `json:"nodeName"`
+	MemoryCapacity    resourceapi.Quantity `json:"memoryCapacity"`
+	CPUCapacity       resourceapi.Quantity `json:"cpuCapacity"`
+	MemoryAllocatable resourceapi.Quantity `json:"memoryAllocatable"`
+	CPUAllocatable    resourceapi.Quantity `json:"cpuAllocatable"`
+	MemoryRequests    resourceapi.Quantity `json:"memoryRequests"`
+	CPURequests       resourceapi.Quantity `json:"cpuRequests"`
+}
+
+// ResourceNames returns the resources referenced by the node or its pods.
+func (na *NodeAllocated) ResourceNames() []v1.ResourceName {
+	found := map[v1.ResourceName]bool{}
+	names := []v1.ResourceName{}
+	for _, list := range []v1.ResourceList{na.Capacity, na.Allocatable, na.Requests, na.Limits} {
+		for name := range list {
+			if !found[name] {
+				found[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+// ToRecord returns the node as a record line, for use as scraper output.
+func (na *NodeAllocated) ToRecord() (string, error) {
+	return common.NewRecord(common.NodeRecordKind, na)
+}
 
-func parseNodeAllocated(inputNode string) *NodeAllocated {
-	re := regexp.MustCompile(NodeExpr)
-	if re.MatchString(inputNode) {
-		// get the portion captured by parenthesis in the expr
-		matches := re.FindStringSubmatch(inputNode)
+// parseNodeAllocatedRecord returns nil if the record is not a node record.
+func parseNodeAllocatedRecord(line string) (*NodeAllocated, error) {
+	record, err := common.ParseRecord(line)
+	if err != nil {
+		return nil, err
+	}
+	if record.Kind != common.NodeRecordKind {
+		return nil, nil
+	}
+	if record.Version == 1 {
+		v1Node := nodeAllocatedV1{}
+		if err := record.Decode(&v1Node); err != nil {
+			return nil, err
+		}
 		return &NodeAllocated{
-			NodeName:          matches[1],
-			MemoryAllocatable: resourceapi.MustParse(matches[3]),
-			CPUAllocatable:    resourceapi.MustParse(matches[5]),
-			MemoryRequests:    resourceapi.MustParse(matches[2]),
-			CPURequests:       resourceapi.MustParse(matches[4]),
+			NodeName: v1Node.NodeName,
+			Capacity: v1.ResourceList{
+				v1.ResourceMemory: v1Node.MemoryCapacity,
+				v1.ResourceCPU:    v1Node.CPUCapacity,
+			},
+			Allocatable: v1.ResourceList{
+				v1.ResourceMemory: v1Node.MemoryAllocatable,
+				v1.ResourceCPU:    v1Node.CPUAllocatable,
+			},
+			Requests: v1.ResourceList{
+				v1.ResourceMemory: v1Node.MemoryRequests,
+				v1.ResourceCPU:    v1Node.CPURequests,
+			},
+		}, nil
+	}
+	nodeAllocated := &NodeAllocated{}
+	if err := record.Decode(nodeAllocated); err != nil {
+		return nil, err
+	}
+	return nodeAllocated, nil
+}
+
+const NodeExpr = `^NodeName: (.*), Memory: (.*) / (.*) = .*, CPU: (.*) / (.*) = .*$`
+
+var nodeRegexp = regexp.MustCompile(NodeExpr)
+
+// parseNodeAllocated returns nil if the line is not a node in the legacy
+// output format, and an error if its quantities can not be parsed.
+func parseNodeAllocated(inputNode string) (*NodeAllocated, error) {
+	// get the portion captured by parenthesis in the expr
+	matches := nodeRegexp.FindStringSubmatch(inputNode)
+	if matches == nil {
+		return nil, nil
+	}
+	quantities := make([]resourceapi.Quantity, len(matches))
+	for i := 2; i < len(matches); i++ {
+		q, err := resourceapi.ParseQuantity(matches[i])
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse node %s, invalid quantity %q: %v", matches[1], matches[i], err)
 		}
+		quantities[i] = q
 	}
-	return nil
+	return &NodeAllocated{
+		NodeName: matches[1],
+		Allocatable: v1.ResourceList{
+			v1.ResourceMemory: quantities[3],
+			v1.ResourceCPU:    quantities[5],
+		},
+		Requests: v1.ResourceList{
+			v1.ResourceMemory: quantities[2],
+			v1.ResourceCPU:    quantities[4],
+		},
+	}, nil
 }
 
 const allocatableTemplate = "NodeName: %s, Memory: %s / %s = %v%%, CPU: %s / %s = %v%%"
 
 func (na *NodeAllocated) String() string {
-	return fmt.Sprintf(allocatableTemplate, na.NodeName, na.MemoryRequests.String(), na.MemoryAllocatable.String(), na.GetMemoryPercent(), na.CPURequests.String(), na.CPUAllocatable.String(), na.GetCPUPercent())
+	memoryRequests, memoryAllocatable := na.Requests[v1.ResourceMemory], na.Allocatable[v1.ResourceMemory]
+	cpuRequests, cpuAllocatable := na.Requests[v1.ResourceCPU], na.Allocatable[v1.ResourceCPU]
+	return fmt.Sprintf(allocatableTemplate, na.NodeName, memoryRequests.String(), memoryAllocatable.String(), na.GetMemoryPercent(), cpuRequests.String(), cpuAllocatable.String(), na.GetCPUPercent())
 }
 
 func (na *NodeAllocated) GetMemoryPercent() int64 {
-	return 100.0 * na.MemoryRequests.Value() / na.MemoryAllocatable.Value()
+	return na.GetPercent(v1.ResourceMemory)
 }
 
 func (na *NodeAllocated) GetCPUPercent() int64 {
-	return 100.0 * na.CPURequests.MilliValue() / na.CPUAllocatable.MilliValue()
+	return na.GetPercent(v1.ResourceCPU)
+}
+
+// GetOvercommitRatio returns the ratio of limits to allocatable for the
+// resource.  A ratio above 1 means the node is overcommitted.
+func (na *NodeAllocated) GetOvercommitRatio(name v1.ResourceName) float64 {
+	allocatable := QuantityValue(name, na.Allocatable[name])
+	if allocatable == 0 {
+		return 0
+	}
+	return float64(QuantityValue(name, na.Limits[name])) / float64(allocatable)
+}
+
+// GetPercent returns requests as a percentage of allocatable for the resource.
+func (na *NodeAllocated) GetPercent(name v1.ResourceName) int64 {
+	allocatable := QuantityValue(name, na.Allocatable[name])
+	if allocatable == 0 {
+		return 0
+	}
+	return 100.0 * QuantityValue(name, na.Requests[name]) / allocatable
 }
@@ -0,0 +1,125 @@
+package types
+
+import (
+	"testing"
+
+	"k8s.io/api/core/v1"
+	resourceapi "k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestParseClusterAllocatedLegacy(t *testing.T) {
+	testCases := []struct {
+		name      string
+		lines     []string
+		wantNodes int
+		wantErr   bool
+	}{
+		{
+			name: "valid nodes",
+			lines: []string{
+				"starting shell script",
+				"Getting Node Allocatable",
+				"NodeName: a, Memory: 1Gi / 2Gi = 50%, CPU: 500m / 1 = 50%",
+				"NodeName: b, Memory: 0 / 2Gi = 0%, CPU: 0 / 1 = 0%",
+			},
+			wantNodes: 2,
+		},
+		{
+			name:      "other lines are ignored",
+			lines:     []string{"starting shell script", "Retrying...", NoNodesFound},
+			wantNodes: 0,
+		},
+		{
+			name:    "malformed quantity",
+			lines:   []string{"NodeName: a, Memory: lots / 2Gi = 50%, CPU: 500m / 1 = 50%"},
+			wantErr: true,
+		},
+		{
+			name:    "empty quantity",
+			lines:   []string{"NodeName: a, Memory: 1Gi / 2Gi = 50%, CPU:  / 1 = 50%"},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			nodes, err := ParseClusterAllocated(tc.lines)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("ParseClusterAllocated() = %+v, want an error", nodes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseClusterAllocated() returned error: %v", err)
+			}
+			if len(nodes) != tc.wantNodes {
+				t.Fatalf("got %d nodes, want %d", len(nodes), tc.wantNodes)
+			}
+		})
+	}
+
+	nodes, _ := ParseClusterAllocated([]string{"NodeName: a, Memory: 1Gi / 2Gi = 50%, CPU: 500m / 1 = 50%"})
+	memory, cpu := nodes[0].Allocatable[v1.ResourceMemory], nodes[0].Requests[v1.ResourceCPU]
+	if memory.Value() != 2<<30 || cpu.MilliValue() != 500 {
+		t.Errorf("got allocatable memory %v and cpu requests %v, want 2Gi and 500m", memory.String(), cpu.String())
+	}
+}
+
+func TestParseNodeAllocatedRecord(t *testing.T) {
+	v1Record := `{"version":1,"kind":"node","data":{"nodeName":"a","memoryCapacity":"4Gi","cpuCapacity":"2","memoryAllocatable":"3Gi","cpuAllocatable":"1930m","memoryRequests":"1Gi","cpuRequests":"500m"}}`
+	node, err := parseNodeAllocatedRecord(v1Record)
+	if err != nil {
+		t.Fatalf("parseNodeAllocatedRecord() returned error: %v", err)
+	}
+	if node.NodeName != "a" {
+		t.Errorf("got node %q, want a", node.NodeName)
+	}
+	expectResourceList(t, "capacity", node.Capacity, v1.ResourceList{v1.ResourceMemory: resourceapi.MustParse("4Gi"), v1.ResourceCPU: resourceapi.MustParse("2")})
+	expectResourceList(t, "allocatable", node.Allocatable, v1.ResourceList{v1.ResourceMemory: resourceapi.MustParse("3Gi"), v1.ResourceCPU: resourceapi.MustParse("1930m")})
+	expectResourceList(t, "requests", node.Requests, v1.ResourceList{v1.ResourceMemory: resourceapi.MustParse("1Gi"), v1.ResourceCPU: resourceapi.MustParse("500m")})
+
+	want := NodeAllocated{
+		NodeName:    "b",
+		Capacity:    v1.ResourceList{v1.ResourceCPU: resourceapi.MustParse("4"), "nvidia.com/gpu": resourceapi.MustParse("1")},
+		Allocatable: v1.ResourceList{v1.ResourceCPU: resourceapi.MustParse("3920m"), "nvidia.com/gpu": resourceapi.MustParse("1")},
+		Requests:    v1.ResourceList{v1.ResourceCPU: resourceapi.MustParse("1")},
+	}
+	record, err := want.ToRecord()
+	if err != nil {
+		t.Fatalf("ToRecord() returned error: %v", err)
+	}
+	node, err = parseNodeAllocatedRecord(record)
+	if err != nil {
+		t.Fatalf("parseNodeAllocatedRecord() returned error: %v", err)
+	}
+	if node.NodeName != want.NodeName {
+		t.Errorf("got node %q, want %q", node.NodeName, want.NodeName)
+	}
+	expectResourceList(t, "capacity", node.Capacity, want.Capacity)
+	expectResourceList(t, "allocatable", node.Allocatable, want.Allocatable)
+	expectResourceList(t, "requests", node.Requests, want.Requests)
+
+	if node, err := parseNodeAllocatedRecord(`{"version":2,"kind":"event","data":{}}`); node != nil || err != nil {
+		t.Errorf("parseNodeAllocatedRecord() of an event = %+v, %v, want neither a node nor an error", node, err)
+	}
+}
+
+func TestResourceDisplayName(t *testing.T) {
+	testCases := []struct {
+		name v1.ResourceName
+		want string
+	}{
+		{name: v1.ResourceCPU, want: "CPU"},
+		{name: v1.ResourceMemory, want: "Memory"},
+		{name: v1.ResourceEphemeralStorage, want: "Ephemeral Storage"},
+		{name: v1.ResourcePods, want: "Pods"},
+		{name: "hugepages-2Mi", want: "Hugepages-2Mi"},
+		{name: "nvidia.com/gpu", want: "Nvidia.com/gpu"},
+		{name: "", want: ""},
+	}
+	for _, tc := range testCases {
+		if got := resourceDisplayName(tc.name); got != tc.want {
+			t.Errorf("resourceDisplayName(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
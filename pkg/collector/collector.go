@@ -0,0 +1,145 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/dashpole/allocatable/pkg/common"
+)
+
+// defaultPageSize is the number of objects requested per List call.  Large
+// clusters can have tens of thousands of pods and events, so we page through
+// them rather than asking the API server for everything at once.
+const defaultPageSize = 500
+
+// Stages of a scrape, reported in failure records.
+const (
+	ConnectStage    = "connect"
+	ListPodsStage   = "listPods"
+	ListNodesStage  = "listNodes"
+	ListEventsStage = "listEvents"
+)
+
+// Error is an error from a stage of a scrape.
+type Error struct {
+	Stage string
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// NewFailure returns the failure record for an error from the given attempt
+// at a scrape.  final is true if the scraper gives up after the attempt.
+func NewFailure(err error, attempt int, final bool) common.Failure {
+	failure := common.Failure{
+		Error:   err.Error(),
+		Attempt: attempt,
+		Final:   final,
+	}
+	var stageErr *Error
+	if errors.As(err, &stageErr) {
+		failure.Stage = stageErr.Stage
+	}
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		failure.StatusCode = status.Status().Code
+	}
+	return failure
+}
+
+// Collector lists the objects the scrapers need directly from the API server.
+type Collector struct {
+	client   kubernetes.Interface
+	pageSize int64
+}
+
+// NewClientset builds a clientset the same way kubectl does: kubeconfig (or
+// $KUBECONFIG and ~/.kube/config if empty), with masterURL overriding the
+// server.  If no configuration is found, the in-cluster config is used.
+func NewClientset(masterURL, kubeconfig string) (kubernetes.Interface, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = kubeconfig
+	overrides := &clientcmd.ConfigOverrides{ClusterInfo: clientcmdapi.Cluster{Server: masterURL}}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides).ClientConfig()
+	if err != nil {
+		return nil, &Error{Stage: ConnectStage, Err: fmt.Errorf("Error building client config: %w", err)}
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, &Error{Stage: ConnectStage, Err: fmt.Errorf("Error creating clientset: %w", err)}
+	}
+	return client, nil
+}
+
+// NewCollector returns a Collector which uses the given client.
+func NewCollector(client kubernetes.Interface) *Collector {
+	return &Collector{
+		client:   client,
+		pageSize: defaultPageSize,
+	}
+}
+
+// ListPods returns the pods in all namespaces.
+func (c *Collector) ListPods(ctx context.Context) ([]v1.Pod, error) {
+	pods := []v1.Pod{}
+	opts := metav1.ListOptions{Limit: c.pageSize}
+	for {
+		podList, err := c.client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, opts)
+		if err != nil {
+			return nil, &Error{Stage: ListPodsStage, Err: fmt.Errorf("Error listing pods: %w", err)}
+		}
+		pods = append(pods, podList.Items...)
+		if podList.Continue == "" {
+			return pods, nil
+		}
+		opts.Continue = podList.Continue
+	}
+}
+
+// ListNodes returns all nodes in the cluster.
+func (c *Collector) ListNodes(ctx context.Context) ([]v1.Node, error) {
+	nodes := []v1.Node{}
+	opts := metav1.ListOptions{Limit: c.pageSize}
+	for {
+		nodeList, err := c.client.CoreV1().Nodes().List(ctx, opts)
+		if err != nil {
+			return nil, &Error{Stage: ListNodesStage, Err: fmt.Errorf("Error listing nodes: %w", err)}
+		}
+		nodes = append(nodes, nodeList.Items...)
+		if nodeList.Continue == "" {
+			return nodes, nil
+		}
+		opts.Continue = nodeList.Continue
+	}
+}
+
+// ListEvents returns the events in all namespaces.
+func (c *Collector) ListEvents(ctx context.Context) ([]v1.Event, error) {
+	events := []v1.Event{}
+	opts := metav1.ListOptions{Limit: c.pageSize}
+	for {
+		eventList, err := c.client.CoreV1().Events(metav1.NamespaceAll).List(ctx, opts)
+		if err != nil {
+			return nil, &Error{Stage: ListEventsStage, Err: fmt.Errorf("Error listing events: %w", err)}
+		}
+		events = append(events, eventList.Items...)
+		if eventList.Continue == "" {
+			return events, nil
+		}
+		opts.Continue = eventList.Continue
+	}
+}
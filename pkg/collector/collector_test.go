@@ -0,0 +1,174 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// paginate makes the fake clientset return list of the resource in pages of
+// pageSize objects, using the index of the next object as the continue token.
+// It returns a pointer to the number of List calls made.
+func paginate(client *fake.Clientset, resource string, pageSize int, list func(items int, start int, cont string) runtime.Object, total int) *int {
+	calls := 0
+	client.PrependReactor("list", resource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+		calls++
+		opts := action.(k8stesting.ListActionImpl).GetListOptions()
+		if opts.Limit != int64(pageSize) {
+			return true, nil, fmt.Errorf("expected limit %d, got %d", pageSize, opts.Limit)
+		}
+		start := 0
+		if opts.Continue != "" {
+			fmt.Sscanf(opts.Continue, "%d", &start)
+		}
+		end := start + pageSize
+		cont := fmt.Sprintf("%d", end)
+		if end >= total {
+			end = total
+			cont = ""
+		}
+		return true, list(end-start, start, cont), nil
+	})
+	return &calls
+}
+
+func podPages(items, start int, cont string) runtime.Object {
+	list := &v1.PodList{ListMeta: metav1.ListMeta{Continue: cont}}
+	for i := 0; i < items; i++ {
+		list.Items = append(list.Items, v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("pod-%d", start+i)}})
+	}
+	return list
+}
+
+func TestListPaginates(t *testing.T) {
+	testCases := []struct {
+		name      string
+		total     int
+		wantCalls int
+	}{
+		{name: "empty", total: 0, wantCalls: 1},
+		{name: "one page", total: 2, wantCalls: 1},
+		{name: "exactly one page", total: 3, wantCalls: 1},
+		{name: "several pages", total: 7, wantCalls: 3},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			podCalls := paginate(client, "pods", 3, podPages, tc.total)
+			nodeCalls := paginate(client, "nodes", 3, func(items, start int, cont string) runtime.Object {
+				list := &v1.NodeList{ListMeta: metav1.ListMeta{Continue: cont}}
+				for i := 0; i < items; i++ {
+					list.Items = append(list.Items, v1.Node{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("node-%d", start+i)}})
+				}
+				return list
+			}, tc.total)
+			eventCalls := paginate(client, "events", 3, func(items, start int, cont string) runtime.Object {
+				list := &v1.EventList{ListMeta: metav1.ListMeta{Continue: cont}}
+				for i := 0; i < items; i++ {
+					list.Items = append(list.Items, v1.Event{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("event-%d", start+i)}})
+				}
+				return list
+			}, tc.total)
+			c := NewCollector(client)
+			c.pageSize = 3
+
+			pods, err := c.ListPods(context.Background())
+			if err != nil {
+				t.Fatalf("ListPods() returned error: %v", err)
+			}
+			nodes, err := c.ListNodes(context.Background())
+			if err != nil {
+				t.Fatalf("ListNodes() returned error: %v", err)
+			}
+			events, err := c.ListEvents(context.Background())
+			if err != nil {
+				t.Fatalf("ListEvents() returned error: %v", err)
+			}
+			if len(pods) != tc.total || len(nodes) != tc.total || len(events) != tc.total {
+				t.Fatalf("got %d pods, %d nodes and %d events, want %d of each", len(pods), len(nodes), len(events), tc.total)
+			}
+			for i := range pods {
+				if want := fmt.Sprintf("pod-%d", i); pods[i].Name != want {
+					t.Errorf("pods[%d] = %s, want %s", i, pods[i].Name, want)
+				}
+			}
+			if *podCalls != tc.wantCalls || *nodeCalls != tc.wantCalls || *eventCalls != tc.wantCalls {
+				t.Errorf("got %d, %d and %d List calls, want %d each", *podCalls, *nodeCalls, *eventCalls, tc.wantCalls)
+			}
+		})
+	}
+}
+
+func TestListDefaultPageSize(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	calls := paginate(client, "pods", defaultPageSize, podPages, 1200)
+	pods, err := NewCollector(client).ListPods(context.Background())
+	if err != nil {
+		t.Fatalf("ListPods() returned error: %v", err)
+	}
+	if len(pods) != 1200 || *calls != 3 {
+		t.Errorf("got %d pods in %d List calls, want 1200 pods in 3 pages of %d", len(pods), *calls, defaultPageSize)
+	}
+}
+
+func TestListObjects(t *testing.T) {
+	c := NewCollector(fake.NewSimpleClientset(
+		&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}},
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "one"}},
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "two"}},
+	))
+	pods, err := c.ListPods(context.Background())
+	if err != nil || len(pods) != 2 {
+		t.Errorf("ListPods() = %d pods, %v, want 2 pods from all namespaces", len(pods), err)
+	}
+	nodes, err := c.ListNodes(context.Background())
+	if err != nil || len(nodes) != 1 {
+		t.Errorf("ListNodes() = %d nodes, %v, want 1 node", len(nodes), err)
+	}
+}
+
+func TestListError(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	forbidden := apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "", errors.New("denied"))
+	calls := 0
+	client.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		calls++
+		if calls == 1 {
+			return true, &v1.PodList{ListMeta: metav1.ListMeta{Continue: "1"}, Items: []v1.Pod{{}}}, nil
+		}
+		return true, nil, forbidden
+	})
+	c := NewCollector(client)
+
+	pods, err := c.ListPods(context.Background())
+	if err == nil {
+		t.Fatalf("ListPods() = %d pods, want an error from the second page", len(pods))
+	}
+	if pods != nil {
+		t.Errorf("ListPods() returned %d pods along with the error, want none", len(pods))
+	}
+	if !strings.HasPrefix(err.Error(), "Error listing pods") || !strings.Contains(err.Error(), forbidden.Error()) {
+		t.Errorf("ListPods() error %q does not describe the API error %q", err, forbidden)
+	}
+	var stageErr *Error
+	if !errors.As(err, &stageErr) || stageErr.Stage != ListPodsStage {
+		t.Errorf("ListPods() error %v is not an Error of stage %s", err, ListPodsStage)
+	}
+	if !apierrors.IsForbidden(err) {
+		t.Errorf("ListPods() error %v does not wrap the API error", err)
+	}
+	failure := NewFailure(err, 2, true)
+	if failure.Stage != ListPodsStage || failure.StatusCode != 403 || failure.Attempt != 2 || !failure.Final {
+		t.Errorf("NewFailure() = %+v, want stage %s, status 403, attempt 2 and final", failure, ListPodsStage)
+	}
+}
@@ -0,0 +1,161 @@
+package collector
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy configures how the scrapers retry failed attempts to get data
+// from a cluster.
+type RetryPolicy struct {
+	// Attempts is the maximum number of attempts of each stage of a scrape.
+	Attempts int
+	// InitialBackoff is the wait after the first failed attempt.  It doubles
+	// after every failed attempt, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Jitter randomizes each wait by up to this fraction of it, so that
+	// clusters which fail together do not retry together.
+	Jitter float64
+	// AttemptTimeout is the deadline of each attempt.  Zero means no deadline.
+	AttemptTimeout time.Duration
+	// Budget is the deadline of the whole scrape, including every stage and
+	// retry.  Zero means no deadline.
+	Budget time.Duration
+}
+
+// DefaultRetryPolicy is used unless overridden by flags or the environment.
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:       3,
+	InitialBackoff: 10 * time.Second,
+	MaxBackoff:     time.Minute,
+	Jitter:         0.2,
+	AttemptTimeout: 2 * time.Minute,
+	Budget:         5 * time.Minute,
+}
+
+// RegisterRetryFlags registers flags for the retry policy.  As the scrapers
+// are usually run by foreachmaster without flags, the defaults can also be set
+// with environment variables, e.g. SCRAPE_ATTEMPTS=5 or SCRAPE_BUDGET=10m.
+func RegisterRetryFlags() *RetryPolicy {
+	p := &RetryPolicy{}
+	flag.IntVar(&p.Attempts, "attempts", envInt("SCRAPE_ATTEMPTS", DefaultRetryPolicy.Attempts), "maximum number of attempts of each stage of the scrape (env SCRAPE_ATTEMPTS)")
+	flag.DurationVar(&p.InitialBackoff, "initial-backoff", envDuration("SCRAPE_INITIAL_BACKOFF", DefaultRetryPolicy.InitialBackoff), "wait after the first failed attempt, doubled after each failed attempt (env SCRAPE_INITIAL_BACKOFF)")
+	flag.DurationVar(&p.MaxBackoff, "max-backoff", envDuration("SCRAPE_MAX_BACKOFF", DefaultRetryPolicy.MaxBackoff), "maximum wait between attempts (env SCRAPE_MAX_BACKOFF)")
+	flag.Float64Var(&p.Jitter, "backoff-jitter", envFloat("SCRAPE_BACKOFF_JITTER", DefaultRetryPolicy.Jitter), "fraction by which each wait is randomized (env SCRAPE_BACKOFF_JITTER)")
+	flag.DurationVar(&p.AttemptTimeout, "attempt-timeout", envDuration("SCRAPE_ATTEMPT_TIMEOUT", DefaultRetryPolicy.AttemptTimeout), "deadline of each attempt; 0 means none (env SCRAPE_ATTEMPT_TIMEOUT)")
+	flag.DurationVar(&p.Budget, "scrape-budget", envDuration("SCRAPE_BUDGET", DefaultRetryPolicy.Budget), "deadline of the whole scrape, including retries; 0 means none (env SCRAPE_BUDGET)")
+	return p
+}
+
+// WithBudget returns a context which is cancelled when the scrape's budget
+// runs out.
+func (p *RetryPolicy) WithBudget(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.Budget <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, p.Budget)
+}
+
+// Retry calls attempt until it succeeds, the attempts are used up, or the
+// next wait would not fit in ctx's deadline.  failed is called after each
+// failed attempt, with final set if it is the last one.  There is no wait
+// after the last attempt.  It returns the error of the last attempt.
+func (p *RetryPolicy) Retry(ctx context.Context, attempt func(ctx context.Context) error, failed func(err error, attempt int, final bool)) error {
+	for i := 1; ; i++ {
+		err := p.try(ctx, attempt)
+		if err == nil {
+			return nil
+		}
+		wait := p.backoff(i)
+		final := i >= p.Attempts || !fitsDeadline(ctx, wait)
+		failed(err, i, final)
+		if final {
+			return err
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+func (p *RetryPolicy) try(ctx context.Context, attempt func(ctx context.Context) error) error {
+	if p.AttemptTimeout <= 0 {
+		return attempt(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.AttemptTimeout)
+	defer cancel()
+	return attempt(ctx)
+}
+
+// backoff returns the wait after the given failed attempt.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	wait := float64(p.InitialBackoff) * math.Pow(2, float64(attempt-1))
+	if p.MaxBackoff > 0 && wait > float64(p.MaxBackoff) {
+		wait = float64(p.MaxBackoff)
+	}
+	wait *= 1 + p.Jitter*(2*rand.Float64()-1)
+	if wait < 0 {
+		return 0
+	}
+	return time.Duration(wait)
+}
+
+// fitsDeadline returns true if ctx is not done, and will not be done after
+// waiting.
+func fitsDeadline(ctx context.Context, wait time.Duration) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	deadline, ok := ctx.Deadline()
+	return !ok || time.Until(deadline) > wait
+}
+
+func envInt(name string, defaultValue int) int {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return defaultValue
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ignoring invalid %s: %v\n", name, err)
+		return defaultValue
+	}
+	return i
+}
+
+func envFloat(name string, defaultValue float64) float64 {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return defaultValue
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ignoring invalid %s: %v\n", name, err)
+		return defaultValue
+	}
+	return f
+}
+
+func envDuration(name string, defaultValue time.Duration) time.Duration {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ignoring invalid %s: %v\n", name, err)
+		return defaultValue
+	}
+	return d
+}
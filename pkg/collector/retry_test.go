@@ -0,0 +1,194 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	p := &RetryPolicy{InitialBackoff: 10 * time.Second, MaxBackoff: time.Minute}
+	testCases := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: 10 * time.Second},
+		{attempt: 2, want: 20 * time.Second},
+		{attempt: 3, want: 40 * time.Second},
+		{attempt: 4, want: time.Minute},
+		{attempt: 5, want: time.Minute},
+		{attempt: 100, want: time.Minute},
+	}
+	for _, tc := range testCases {
+		if got := p.backoff(tc.attempt); got != tc.want {
+			t.Errorf("backoff(%d) = %v, want %v", tc.attempt, got, tc.want)
+		}
+	}
+
+	// jitter is applied after the cap
+	p.Jitter = 0.2
+	for i := 0; i < 100; i++ {
+		if got := p.backoff(10); got < 48*time.Second || got > 72*time.Second {
+			t.Fatalf("backoff(10) = %v with 20%% jitter, want within 20%% of %v", got, time.Minute)
+		}
+	}
+}
+
+func TestFitsDeadline(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	soon, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	testCases := []struct {
+		name string
+		ctx  context.Context
+		wait time.Duration
+		want bool
+	}{
+		{name: "no deadline", ctx: context.Background(), wait: time.Hour, want: true},
+		{name: "wait before the deadline", ctx: soon, wait: time.Millisecond, want: true},
+		{name: "wait past the deadline", ctx: soon, wait: time.Minute, want: false},
+		{name: "cancelled", ctx: cancelled, wait: 0, want: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := fitsDeadline(tc.ctx, tc.wait); got != tc.want {
+				t.Errorf("fitsDeadline() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// failedAttempt records a call to the failed callback of Retry, and when it
+// was made.
+type failedAttempt struct {
+	attempt int
+	final   bool
+	at      time.Time
+}
+
+func TestRetry(t *testing.T) {
+	testCases := []struct {
+		name      string
+		attempts  int
+		succeedOn int
+		want      []failedAttempt
+		wantErr   bool
+	}{
+		{
+			name:      "first attempt succeeds",
+			attempts:  3,
+			succeedOn: 1,
+			want:      []failedAttempt{},
+		},
+		{
+			name:      "retry succeeds",
+			attempts:  3,
+			succeedOn: 3,
+			want:      []failedAttempt{{attempt: 1}, {attempt: 2}},
+		},
+		{
+			name:     "attempts used up",
+			attempts: 3,
+			want:     []failedAttempt{{attempt: 1}, {attempt: 2}, {attempt: 3, final: true}},
+			wantErr:  true,
+		},
+		{
+			name:     "single attempt",
+			attempts: 1,
+			want:     []failedAttempt{{attempt: 1, final: true}},
+			wantErr:  true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &RetryPolicy{Attempts: tc.attempts, InitialBackoff: 10 * time.Millisecond, MaxBackoff: 15 * time.Millisecond}
+			calls := 0
+			got := []failedAttempt{}
+			err := p.Retry(context.Background(), func(ctx context.Context) error {
+				calls++
+				if calls == tc.succeedOn {
+					return nil
+				}
+				return errors.New("failed")
+			}, func(err error, attempt int, final bool) {
+				got = append(got, failedAttempt{attempt: attempt, final: final, at: time.Now()})
+			})
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Retry() returned error %v, want error %v", err, tc.wantErr)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("got failed attempts %+v, want %+v", got, tc.want)
+			}
+			for i := range got {
+				if got[i].attempt != tc.want[i].attempt || got[i].final != tc.want[i].final {
+					t.Errorf("got failed attempts %+v, want %+v", got, tc.want)
+				}
+				// without jitter, each retry waits at least the backoff of
+				// the attempt before it
+				if i > 0 {
+					if waited, want := got[i].at.Sub(got[i-1].at), p.backoff(i); waited < want {
+						t.Errorf("attempt %d was %v after attempt %d, want at least %v", got[i].attempt, waited, got[i-1].attempt, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRetryDoesNotWaitAfterFinalAttempt(t *testing.T) {
+	// the wait after the second attempt would be 400ms
+	p := &RetryPolicy{Attempts: 2, InitialBackoff: 200 * time.Millisecond}
+	var final time.Time
+	err := p.Retry(context.Background(), func(ctx context.Context) error {
+		return errors.New("failed")
+	}, func(err error, attempt int, isFinal bool) {
+		if isFinal {
+			final = time.Now()
+		}
+	})
+	if err == nil || final.IsZero() {
+		t.Fatalf("Retry() = %v, want the error of a final attempt", err)
+	}
+	if waited := time.Since(final); waited > 100*time.Millisecond {
+		t.Errorf("Retry() returned %v after the final attempt, want no wait", waited)
+	}
+}
+
+func TestRetryStopsWhenBudgetCannotFitWait(t *testing.T) {
+	p := &RetryPolicy{Attempts: 5, InitialBackoff: time.Second, MaxBackoff: time.Minute, Budget: 200 * time.Millisecond}
+	ctx, cancel := p.WithBudget(context.Background())
+	defer cancel()
+	start := time.Now()
+	got := []failedAttempt{}
+	err := p.Retry(ctx, func(ctx context.Context) error {
+		return errors.New("failed")
+	}, func(err error, attempt int, final bool) {
+		got = append(got, failedAttempt{attempt: attempt, final: final})
+	})
+	if err == nil {
+		t.Fatal("Retry() succeeded, want an error")
+	}
+	if len(got) != 1 || !got[0].final {
+		t.Errorf("got failed attempts %+v, want a single final attempt", got)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Retry() took %v, want it to give up without waiting for the budget", elapsed)
+	}
+}
+
+func TestRetryStopsWhenCancelledDuringWait(t *testing.T) {
+	p := &RetryPolicy{Attempts: 5, InitialBackoff: time.Minute}
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := p.Retry(ctx, func(ctx context.Context) error {
+		calls++
+		return errors.New("failed")
+	}, func(err error, attempt int, final bool) {
+		cancel()
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("Retry() = %v after %d attempts, want the error of the only attempt", err, calls)
+	}
+}
@@ -1,14 +1,25 @@
 package common
 
 import (
+	"bytes"
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"os"
-	"regexp"
+	"strconv"
 	"strings"
 )
 
-const clusterExpr = `^(\{.*\}) output: \"(.*)\"$`
+// clusterSeparator separates the cluster identifier from the quoted output in
+// a foreachmaster line, e.g. {"project": "p"} output: "...".  Lines are split
+// at the first separator, as the output may itself contain one.  Lines are
+// parsed without a regexp, as they are read sequentially and can be many
+// megabytes long.
+const clusterSeparator = `} output: "`
+
+// maxErrorInputLength limits how much of a line is included in errors, as
+// lines can be many megabytes long.
+const maxErrorInputLength = 200
 
 func ToCSV(filename string, data [][]string) error {
 	file, err := os.Create(filename)
@@ -24,10 +35,69 @@ func ToCSV(filename string, data [][]string) error {
 	return nil
 }
 
+func ToJSON(filename string, data interface{}) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(data)
+}
+
+// ParseForeachMasterLine returns the cluster identifier and the lines of
+// output of a foreachmaster line.  The output is unescaped before it is split
+// into lines, and carriage returns at the end of lines are removed.  Empty
+// output has no lines.
 func ParseForeachMasterLine(input []byte) (string, []string, error) {
-	re := regexp.MustCompile(clusterExpr)
-	if re.Match(input) {
-		return string(re.FindSubmatch(input)[1]), strings.Split(string(re.FindSubmatch(input)[2]), "\\n"), nil
+	separator := bytes.Index(input, []byte(clusterSeparator))
+	end := len(input) - 1
+	if !bytes.HasPrefix(input, []byte("{")) || separator < 0 || end < separator+len(clusterSeparator) || input[end] != '"' {
+		return "", []string{}, fmt.Errorf("Unable to parse foreachmaster, input: %s is not of the form {identifier} output: \"output\"", truncate(string(input)))
+	}
+	id := string(input[:separator+1])
+	quoted := string(input[separator+len(clusterSeparator) : end])
+	output, err := unquoteOutput(quoted)
+	if err != nil {
+		return "", []string{}, fmt.Errorf("Unable to unescape foreachmaster output: %s, error: %v", truncate(quoted), err)
+	}
+	output = strings.TrimSuffix(strings.TrimSuffix(output, "\n"), "\r")
+	if output == "" {
+		return id, []string{}, nil
+	}
+	lines := strings.Split(output, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSuffix(lines[i], "\r")
+	}
+	return id, lines, nil
+}
+
+// isClusterLine returns true if a foreachmaster line holds the output of a
+// cluster, even if the output is truncated or can not be unescaped.
+func isClusterLine(input []byte) bool {
+	return bytes.HasPrefix(input, []byte("{")) && bytes.Contains(input, []byte(clusterSeparator))
+}
+
+// unquoteOutput unescapes the quoted output of a foreachmaster line.
+// foreachmaster quotes output as a Go string, but JSON escapes, such as \/
+// and UTF-16 surrogate pairs, are accepted as well.
+func unquoteOutput(quoted string) (string, error) {
+	output, err := strconv.Unquote(`"` + quoted + `"`)
+	if err == nil {
+		return output, nil
+	}
+	if jsonErr := json.Unmarshal([]byte(`"`+quoted+`"`), &output); jsonErr == nil {
+		return output, nil
+	}
+	return "", err
+}
+
+// truncate shortens input for use in error messages.
+func truncate(input string) string {
+	if len(input) > maxErrorInputLength {
+		return input[:maxErrorInputLength] + "..."
 	}
-	return "", []string{}, fmt.Errorf("Unable to parse foreachmaster, input: %s did not match expr: %s", string(input), clusterExpr)
+	return input
 }
@@ -0,0 +1,181 @@
+package common
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseForeachMasterLine(t *testing.T) {
+	testCases := []struct {
+		name      string
+		input     string
+		wantID    string
+		wantLines []string
+		wantErr   bool
+	}{
+		{
+			name:      "empty output",
+			input:     `{"project": "p"} output: ""`,
+			wantID:    `{"project": "p"}`,
+			wantLines: []string{},
+		},
+		{
+			name:      "only a newline",
+			input:     `{"project": "p"} output: "\n"`,
+			wantID:    `{"project": "p"}`,
+			wantLines: []string{},
+		},
+		{
+			name:      "only a CRLF",
+			input:     `{"project": "p"} output: "\r\n"`,
+			wantID:    `{"project": "p"}`,
+			wantLines: []string{},
+		},
+		{
+			name:      "LF line endings",
+			input:     `{"project": "p"} output: "a\nb\n"`,
+			wantID:    `{"project": "p"}`,
+			wantLines: []string{"a", "b"},
+		},
+		{
+			name:      "CRLF line endings",
+			input:     `{"project": "p"} output: "a\r\nb\r\n"`,
+			wantID:    `{"project": "p"}`,
+			wantLines: []string{"a", "b"},
+		},
+		{
+			name:      "blank lines are kept",
+			input:     `{"project": "p"} output: "a\r\n\r\nb"`,
+			wantID:    `{"project": "p"}`,
+			wantLines: []string{"a", "", "b"},
+		},
+		{
+			name:      "Go escapes",
+			input:     `{"project": "p"} output: ` + strconv.Quote("say \"hi\"\tback\\slash é ☃\nnext"),
+			wantID:    `{"project": "p"}`,
+			wantLines: []string{"say \"hi\"\tback\\slash é ☃", "next"},
+		},
+		{
+			name:      "JSON escapes",
+			input:     `{"project": "p"} output: "a\/b \ud83d\ude00"`,
+			wantID:    `{"project": "p"}`,
+			wantLines: []string{"a/b 😀"},
+		},
+		{
+			name:      "separator in the output",
+			input:     `{"project": "p"} output: "x} output: \"y\""`,
+			wantID:    `{"project": "p"}`,
+			wantLines: []string{`x} output: "y"`},
+		},
+		{
+			name:    "invalid escape",
+			input:   `{"project": "p"} output: "bad \q"`,
+			wantErr: true,
+		},
+		{
+			name:    "no separator",
+			input:   `{"project": "p"} "output"`,
+			wantErr: true,
+		},
+		{
+			name:    "unterminated output",
+			input:   `{"project": "p"} output: "a`,
+			wantErr: true,
+		},
+		{
+			name:    "empty line",
+			input:   "",
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			id, lines, err := ParseForeachMasterLine([]byte(tc.input))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("ParseForeachMasterLine() = %q, %q, want an error", id, lines)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseForeachMasterLine() returned error: %v", err)
+			}
+			if id != tc.wantID {
+				t.Errorf("got identifier %q, want %q", id, tc.wantID)
+			}
+			if !reflect.DeepEqual(lines, tc.wantLines) {
+				t.Errorf("got lines %q, want %q", lines, tc.wantLines)
+			}
+		})
+	}
+}
+
+func TestUnquoteOutput(t *testing.T) {
+	testCases := []struct {
+		name    string
+		quoted  string
+		want    string
+		wantErr bool
+	}{
+		{name: "empty", quoted: "", want: ""},
+		{name: "plain", quoted: "abc", want: "abc"},
+		{name: "quotes and backslashes", quoted: `\"a\" \\ b`, want: `"a" \ b`},
+		{name: "control characters", quoted: `a\tb\r\nc`, want: "a\tb\r\nc"},
+		{name: "Go unicode escapes", quoted: `é \U0001F600 \xff`, want: "é 😀 \xff"},
+		{name: "JSON solidus", quoted: `a\/b`, want: "a/b"},
+		{name: "JSON surrogate pair", quoted: `\ud83d\ude00`, want: "😀"},
+		{name: "invalid escape", quoted: `\q`, wantErr: true},
+		{name: "unescaped quote", quoted: `a"b`, wantErr: true},
+		{name: "trailing backslash", quoted: `a\`, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := unquoteOutput(tc.quoted)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("unquoteOutput(%q) = %q, want an error", tc.quoted, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unquoteOutput(%q) returned error: %v", tc.quoted, err)
+			}
+			if got != tc.want {
+				t.Errorf("unquoteOutput(%q) = %q, want %q", tc.quoted, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReadForeachMasterLog(t *testing.T) {
+	log := "I0101 00:00:00.000000 foreachmaster.go:1] Running on 3 clusters\r\n" +
+		"{\"cluster\": \"a\"} output: \"x\\r\\ny\"\r\n" +
+		"\r\n" +
+		"{\"cluster\": \"b\"} output: \"\"\r\n" +
+		"{\"cluster\": \"c\"} output: \"truncated\r\n" +
+		"Done"
+	outputs := []ClusterOutput{}
+	malformed := []string{}
+	err := ReadForeachMasterLog(strings.NewReader(log), func(output ClusterOutput) {
+		outputs = append(outputs, output)
+	}, func(location string, err error) {
+		malformed = append(malformed, location)
+	})
+	if err != nil {
+		t.Fatalf("ReadForeachMasterLog() returned error: %v", err)
+	}
+	if len(outputs) != 2 {
+		t.Fatalf("got %d clusters, want 2", len(outputs))
+	}
+	if !reflect.DeepEqual(outputs[0].Lines, []string{"x", "y"}) || len(outputs[1].Lines) != 0 {
+		t.Errorf("got lines %q and %q, want [x y] and none", outputs[0].Lines, outputs[1].Lines)
+	}
+	if outputs[0].Location != "line 2" || outputs[1].Location != "line 4" {
+		t.Errorf("got locations %q and %q, want line 2 and line 4", outputs[0].Location, outputs[1].Location)
+	}
+	if !reflect.DeepEqual(malformed, []string{"line 5"}) {
+		t.Errorf("got malformed lines %q, want only the truncated cluster on line 5", malformed)
+	}
+}
@@ -0,0 +1,92 @@
+package common
+
+// Exit codes of the processors.
+const (
+	// FatalExitCode is used when the input can not be read, or the results
+	// can not be written.
+	FatalExitCode = 1
+	// FailureRateExitCode is used when too many clusters could not be analyzed.
+	FailureRateExitCode = 2
+)
+
+// DefaultMaxFailureRate is the fraction of clusters which the processors
+// tolerate being unable to analyze before exiting with FailureRateExitCode.
+const DefaultMaxFailureRate = 0.5
+
+// ScrapeErrorPrefix starts the lines the scrapers print when they are unable
+// to get data from a cluster, e.g. "Error getting Node Allocatable: ...".
+const ScrapeErrorPrefix = "Error getting"
+
+// Kinds of problems found in the input.
+const (
+	// UnparseableProblem is input which could not be parsed.
+	UnparseableProblem = "unparseable"
+	// ScrapeErrorProblem is a failure reported by the scraper.
+	ScrapeErrorProblem = "scrape-error"
+	// NoNodesProblem is a cluster without any nodes in its output.
+	NoNodesProblem = "no-nodes"
+	// MissingClusterInfoProblem is a cluster without cluster info in its
+	// events output.
+	MissingClusterInfoProblem = "missing-cluster-info"
+)
+
+// Problem is a problem found in the input for a cluster.
+type Problem struct {
+	Kind     string `json:"kind"`
+	Location string `json:"location"`
+	Cluster  string `json:"cluster,omitempty"`
+	Message  string `json:"message"`
+}
+
+// Diagnostics summarizes the problems found in the input.
+type Diagnostics struct {
+	Clusters int `json:"clusters"`
+	// FailedClusters are the clusters which could not be analyzed, as their
+	// status is failed or no-nodes.
+	FailedClusters int     `json:"failedClusters"`
+	FailureRate    float64 `json:"failureRate"`
+	// Statuses is the number of clusters with each status.
+	Statuses map[string]int `json:"statuses"`
+	// Counts is the number of clusters with each kind of problem.
+	Counts   map[string]int `json:"counts"`
+	Problems []Problem      `json:"problems"`
+}
+
+// NewDiagnostics returns diagnostics without any clusters.
+func NewDiagnostics() *Diagnostics {
+	return &Diagnostics{
+		Statuses: map[string]int{},
+		Counts:   map[string]int{},
+		Problems: []Problem{},
+	}
+}
+
+// AddCluster records a cluster with the given status, along with its
+// problems, if any.
+func (d *Diagnostics) AddCluster(status string, problems ...Problem) {
+	d.Clusters++
+	d.Statuses[status]++
+	kinds := map[string]bool{}
+	for _, problem := range problems {
+		d.Problems = append(d.Problems, problem)
+		kinds[problem.Kind] = true
+	}
+	for kind := range kinds {
+		d.Counts[kind]++
+	}
+	if status == FailedStatus || status == NoNodesStatus {
+		d.FailedClusters++
+	}
+	d.FailureRate = float64(d.FailedClusters) / float64(d.Clusters)
+}
+
+// ExceedsFailureRate returns true if the fraction of clusters which could not
+// be analyzed is greater than maxFailureRate.
+func (d *Diagnostics) ExceedsFailureRate(maxFailureRate float64) bool {
+	return d.FailureRate > maxFailureRate
+}
+
+// Write writes the diagnostics to filename as JSON.
+func (d *Diagnostics) Write(filename string) error {
+	return ToJSON(filename, d)
+}
@@ -0,0 +1,28 @@
+package common
+
+import "testing"
+
+func TestExceedsFailureRate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		statuses []string
+		want     bool
+	}{
+		{name: "no clusters", want: false},
+		{name: "all ok", statuses: []string{OKStatus, PartialStatus}, want: false},
+		{name: "half failed", statuses: []string{OKStatus, FailedStatus}, want: false},
+		{name: "most failed", statuses: []string{OKStatus, FailedStatus, NoNodesStatus}, want: true},
+		{name: "all failed", statuses: []string{FailedStatus}, want: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			diagnostics := NewDiagnostics()
+			for _, status := range tc.statuses {
+				diagnostics.AddCluster(status)
+			}
+			if got := diagnostics.ExceedsFailureRate(DefaultMaxFailureRate); got != tc.want {
+				t.Errorf("ExceedsFailureRate(%v) = %v with failure rate %v, want %v", DefaultMaxFailureRate, got, diagnostics.FailureRate, tc.want)
+			}
+		})
+	}
+}
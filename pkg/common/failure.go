@@ -0,0 +1,89 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FailureRecordKind is the kind of the records the scrapers print when they
+// are unable to get data from a cluster.
+const FailureRecordKind = "failure"
+
+// Statuses of a cluster's scrape.
+const (
+	// OKStatus is a scrape which succeeded on the first attempt.
+	OKStatus = "ok"
+	// PartialStatus is a scrape which has data, but also failures, e.g. an
+	// attempt which succeeded when retried.
+	PartialStatus = "partial"
+	// FailedStatus is a scrape without any data.
+	FailedStatus = "failed"
+	// NoNodesStatus is a scrape which succeeded, but found no nodes.
+	NoNodesStatus = "no-nodes"
+)
+
+// Failure is a failed attempt to get data from a cluster.
+type Failure struct {
+	// Stage is the step of the scrape which failed, e.g. listPods.  It is
+	// empty for failures parsed from legacy output.
+	Stage   string `json:"stage,omitempty"`
+	Error   string `json:"error"`
+	Attempt int    `json:"attempt,omitempty"`
+	// Final is true if the scraper gave up after this attempt.
+	Final bool `json:"final"`
+	// StatusCode is the HTTP status code returned by the API server, if any.
+	StatusCode int32 `json:"statusCode,omitempty"`
+}
+
+func (f Failure) String() string {
+	s := f.Error
+	if f.Stage != "" {
+		s = fmt.Sprintf("%s attempt %d: %s", f.Stage, f.Attempt, s)
+	}
+	if f.StatusCode != 0 {
+		s = fmt.Sprintf("%s (status %d)", s, f.StatusCode)
+	}
+	return s
+}
+
+// ToRecord returns the failure as a record line, for use as scraper output.
+func (f Failure) ToRecord() (string, error) {
+	return NewRecord(FailureRecordKind, f)
+}
+
+// GetFailures returns the failures in the scraper output, from failure
+// records, or from the errors the scrapers print in the legacy output format.
+// Errors may follow other output on the same line, e.g. "Retrying...Error
+// getting ...".
+func GetFailures(lines []string) []Failure {
+	failures := []Failure{}
+	for _, line := range lines {
+		if IsRecord(line) {
+			record, err := ParseRecord(line)
+			if err != nil || record.Kind != FailureRecordKind {
+				continue
+			}
+			failure := Failure{}
+			if err := record.Decode(&failure); err == nil {
+				failures = append(failures, failure)
+			}
+			continue
+		}
+		if i := strings.Index(line, ScrapeErrorPrefix); i >= 0 {
+			failures = append(failures, Failure{Error: strings.TrimSpace(line[i:])})
+		}
+	}
+	return failures
+}
+
+// GetStatus returns the status of a scrape, given whether it has data, and
+// its failures.
+func GetStatus(hasData bool, failures []Failure) string {
+	if !hasData {
+		return FailedStatus
+	}
+	if len(failures) > 0 {
+		return PartialStatus
+	}
+	return OKStatus
+}
@@ -0,0 +1,82 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetFailures(t *testing.T) {
+	record, err := Failure{Stage: "listPods", Error: "unavailable", Attempt: 1, StatusCode: 503}.ToRecord()
+	if err != nil {
+		t.Fatal(err)
+	}
+	final, err := Failure{Stage: "listNodes", Error: "forbidden", Attempt: 3, Final: true, StatusCode: 403}.ToRecord()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewRecord(NodeRecordKind, map[string]string{"nodeName": "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name  string
+		lines []string
+		want  []Failure
+	}{
+		{
+			name:  "no failures",
+			lines: []string{"Getting Node Allocatable", other},
+			want:  []Failure{},
+		},
+		{
+			name:  "failure records",
+			lines: []string{"Getting Node Allocatable", record, final},
+			want: []Failure{
+				{Stage: "listPods", Error: "unavailable", Attempt: 1, StatusCode: 503},
+				{Stage: "listNodes", Error: "forbidden", Attempt: 3, Final: true, StatusCode: 403},
+			},
+		},
+		{
+			name:  "legacy errors",
+			lines: []string{"Error getting Node Allocatable: timeout", "Retrying...Error getting Node Allocatable: refused "},
+			want: []Failure{
+				{Error: "Error getting Node Allocatable: timeout"},
+				{Error: "Error getting Node Allocatable: refused"},
+			},
+		},
+		{
+			name:  "malformed record",
+			lines: []string{`{"kind":"failure","version":1,"data":`},
+			want:  []Failure{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := GetFailures(tc.lines); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("GetFailures() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGetStatus(t *testing.T) {
+	failures := []Failure{{Stage: "listPods", Error: "unavailable", Attempt: 1}}
+	testCases := []struct {
+		name     string
+		hasData  bool
+		failures []Failure
+		want     string
+	}{
+		{name: "ok", hasData: true, want: OKStatus},
+		{name: "partial", hasData: true, failures: failures, want: PartialStatus},
+		{name: "failed", hasData: false, failures: failures, want: FailedStatus},
+		{name: "failed without failures", hasData: false, want: FailedStatus},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := GetStatus(tc.hasData, tc.failures); got != tc.want {
+				t.Errorf("GetStatus(%v, %+v) = %s, want %s", tc.hasData, tc.failures, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ClusterIdentifier identifies the cluster that a line of foreachmaster
+// output came from.
+type ClusterIdentifier struct {
+	Project       string `json:"project"`
+	Location      string `json:"location"`
+	Name          string `json:"name"`
+	MasterVersion string `json:"masterVersion"`
+	Shard         string `json:"shard"`
+	// Raw is the identifier as it appears in the log.
+	Raw string `json:"raw"`
+}
+
+// Fields of ClusterIdentifier which clusters can be grouped by.
+const (
+	ProjectField       = "project"
+	LocationField      = "location"
+	MasterVersionField = "version"
+)
+
+// identifierKeys maps the normalized keys which foreachmaster may use for
+// each field to a pointer to that field.
+var identifierKeys = map[string]func(*ClusterIdentifier) *string{
+	"project":              func(c *ClusterIdentifier) *string { return &c.Project },
+	"projectid":            func(c *ClusterIdentifier) *string { return &c.Project },
+	"zone":                 func(c *ClusterIdentifier) *string { return &c.Location },
+	"region":               func(c *ClusterIdentifier) *string { return &c.Location },
+	"location":             func(c *ClusterIdentifier) *string { return &c.Location },
+	"cluster":              func(c *ClusterIdentifier) *string { return &c.Name },
+	"clustername":          func(c *ClusterIdentifier) *string { return &c.Name },
+	"name":                 func(c *ClusterIdentifier) *string { return &c.Name },
+	"masterversion":        func(c *ClusterIdentifier) *string { return &c.MasterVersion },
+	"currentmasterversion": func(c *ClusterIdentifier) *string { return &c.MasterVersion },
+	"version":              func(c *ClusterIdentifier) *string { return &c.MasterVersion },
+	"shard":                func(c *ClusterIdentifier) *string { return &c.Shard },
+}
+
+// ParseClusterIdentifier parses the identifier of a line of foreachmaster
+// output.  The identifier is a JSON object, but identifiers written as
+// {key: value, ...} or key=value,... are also accepted.  Unknown keys are
+// ignored, and if the identifier can not be parsed only Raw is set.
+func ParseClusterIdentifier(raw string) ClusterIdentifier {
+	id := ClusterIdentifier{Raw: raw}
+	fields := map[string]interface{}{}
+	decoder := json.NewDecoder(strings.NewReader(raw))
+	// keep numbers as written, so that a version of 1.30 is not read as 1.3
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil || decoder.More() {
+		fields = map[string]interface{}{}
+		trimmed := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(raw), "{"), "}")
+		for _, pair := range strings.Split(trimmed, ",") {
+			if i := strings.IndexAny(pair, ":="); i > 0 {
+				key := strings.TrimSpace(pair[:i])
+				fields[strings.Trim(key, `"'`)] = strings.Trim(strings.TrimSpace(pair[i+1:]), `"'`)
+			}
+		}
+	}
+	for key, value := range fields {
+		normalized := strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(key))
+		field, ok := identifierKeys[normalized]
+		if !ok || value == nil {
+			continue
+		}
+		if *field(&id) == "" {
+			*field(&id) = fmt.Sprint(value)
+		}
+	}
+	return id
+}
+
+// Group returns the value of the field named by groupBy, which must be one of
+// ProjectField, LocationField or MasterVersionField, or empty for no grouping.
+func (c ClusterIdentifier) Group(groupBy string) string {
+	switch groupBy {
+	case ProjectField:
+		return c.Project
+	case LocationField:
+		return c.Location
+	case MasterVersionField:
+		return c.MasterVersion
+	}
+	return ""
+}
+
+// ToSlice returns the identifier as CSV columns.
+func (c ClusterIdentifier) ToSlice() []string {
+	return []string{c.Project, c.Location, c.Name, c.MasterVersion, c.Shard, c.Raw}
+}
+
+// GetClusterIdentifierHeader returns the CSV header for ClusterIdentifier.ToSlice.
+func GetClusterIdentifierHeader() []string {
+	return []string{"Project", "Location", "Cluster", "Master Version", "Shard", "Identifier"}
+}
+
+// ClusterFilter selects clusters by project, location or master version.
+// Empty fields match every cluster.
+type ClusterFilter struct {
+	Project string
+	// Location also matches a prefix, so a region matches each of its zones.
+	Location string
+	// MasterVersion also matches a prefix, so 1.27 matches 1.27.3.
+	MasterVersion string
+}
+
+// Matches returns true if the cluster passes the filter.
+func (f ClusterFilter) Matches(id ClusterIdentifier) bool {
+	return (f.Project == "" || f.Project == id.Project) &&
+		matchesComponents(id.Location, f.Location, "-") &&
+		matchesComponents(id.MasterVersion, f.MasterVersion, ".-")
+}
+
+// matchesComponents returns true if value equals prefix, or starts with
+// prefix followed by one of the separators.
+func matchesComponents(value, prefix, separators string) bool {
+	if prefix == "" || value == prefix {
+		return true
+	}
+	return strings.HasPrefix(value, prefix) && strings.ContainsRune(separators, rune(value[len(prefix)]))
+}
@@ -0,0 +1,142 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestParseClusterIdentifier(t *testing.T) {
+	testCases := []struct {
+		name string
+		raw  string
+		want ClusterIdentifier
+	}{
+		{
+			name: "json",
+			raw:  `{"project": "p", "location": "us-central1-a", "name": "c", "masterVersion": "1.30.2-gke.1", "shard": "s1"}`,
+			want: ClusterIdentifier{Project: "p", Location: "us-central1-a", Name: "c", MasterVersion: "1.30.2-gke.1", Shard: "s1"},
+		},
+		{
+			name: "json key aliases",
+			raw:  `{"projectId": "p", "zone": "us-central1-a", "clusterName": "c", "current_master_version": "1.29"}`,
+			want: ClusterIdentifier{Project: "p", Location: "us-central1-a", Name: "c", MasterVersion: "1.29"},
+		},
+		{
+			name: "json region",
+			raw:  `{"project": "p", "region": "us-central1", "cluster-name": "c"}`,
+			want: ClusterIdentifier{Project: "p", Location: "us-central1", Name: "c"},
+		},
+		{
+			name: "json numbers keep their formatting",
+			raw:  `{"project": 1234, "name": "c", "version": 1.30, "shard": 7}`,
+			want: ClusterIdentifier{Project: "1234", Name: "c", MasterVersion: "1.30", Shard: "7"},
+		},
+		{
+			name: "json unknown keys and nulls",
+			raw:  `{"project": "p", "nodes": 3, "name": null}`,
+			want: ClusterIdentifier{Project: "p"},
+		},
+		{
+			name: "first alias wins",
+			raw:  `{"zone": "us-central1-a"}`,
+			want: ClusterIdentifier{Location: "us-central1-a"},
+		},
+		{
+			name: "colon form",
+			raw:  `{project: p, zone: us-central1-a, cluster: c}`,
+			want: ClusterIdentifier{Project: "p", Location: "us-central1-a", Name: "c"},
+		},
+		{
+			name: "colon form without spaces",
+			raw:  `{project:p,zone:us-central1-a,cluster:c,version:1.30}`,
+			want: ClusterIdentifier{Project: "p", Location: "us-central1-a", Name: "c", MasterVersion: "1.30"},
+		},
+		{
+			name: "colon form with quotes",
+			raw:  `{'project': 'p', "Cluster_Name": "c"}`,
+			want: ClusterIdentifier{Project: "p", Name: "c"},
+		},
+		{
+			name: "equals form",
+			raw:  `project=p,location=us-central1-a,name=c`,
+			want: ClusterIdentifier{Project: "p", Location: "us-central1-a", Name: "c"},
+		},
+		{
+			name: "equals form with spaces",
+			raw:  `{ project = p , region = us-central1 , clustername = c , masterversion = 1.30 }`,
+			want: ClusterIdentifier{Project: "p", Location: "us-central1", Name: "c", MasterVersion: "1.30"},
+		},
+		{
+			name: "value containing a separator",
+			raw:  `{project: p, name: a:b=c}`,
+			want: ClusterIdentifier{Project: "p", Name: "a:b=c"},
+		},
+		{name: "unparseable", raw: "cluster-1", want: ClusterIdentifier{}},
+		{name: "empty", raw: "", want: ClusterIdentifier{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.want.Raw = tc.raw
+			if got := ParseClusterIdentifier(tc.raw); got != tc.want {
+				t.Errorf("ParseClusterIdentifier(%q) = %+v, want %+v", tc.raw, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestClusterFilterMatches(t *testing.T) {
+	id := ClusterIdentifier{Project: "p", Location: "us-central1-a", MasterVersion: "1.27.3-gke.100"}
+	testCases := []struct {
+		name   string
+		filter ClusterFilter
+		want   bool
+	}{
+		{name: "empty filter", filter: ClusterFilter{}, want: true},
+		{name: "project", filter: ClusterFilter{Project: "p"}, want: true},
+		{name: "other project", filter: ClusterFilter{Project: "q"}, want: false},
+		{name: "project prefix", filter: ClusterFilter{Project: "p-"}, want: false},
+		{name: "zone", filter: ClusterFilter{Location: "us-central1-a"}, want: true},
+		{name: "region", filter: ClusterFilter{Location: "us-central1"}, want: true},
+		{name: "partial region", filter: ClusterFilter{Location: "us-central"}, want: false},
+		{name: "other zone", filter: ClusterFilter{Location: "us-central1-b"}, want: false},
+		{name: "full version", filter: ClusterFilter{MasterVersion: "1.27.3-gke.100"}, want: true},
+		{name: "minor version", filter: ClusterFilter{MasterVersion: "1.27"}, want: true},
+		{name: "patch version", filter: ClusterFilter{MasterVersion: "1.27.3"}, want: true},
+		{name: "partial minor version", filter: ClusterFilter{MasterVersion: "1.2"}, want: false},
+		{name: "other version", filter: ClusterFilter{MasterVersion: "1.28"}, want: false},
+		{name: "all fields", filter: ClusterFilter{Project: "p", Location: "us-central1", MasterVersion: "1.27"}, want: true},
+		{name: "one field does not match", filter: ClusterFilter{Project: "p", Location: "europe-west1", MasterVersion: "1.27"}, want: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.filter.Matches(id); got != tc.want {
+				t.Errorf("%+v.Matches(%+v) = %v, want %v", tc.filter, id, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMatchesComponents(t *testing.T) {
+	testCases := []struct {
+		value      string
+		prefix     string
+		separators string
+		want       bool
+	}{
+		{value: "us-central1-a", prefix: "", separators: "-", want: true},
+		{value: "", prefix: "", separators: "-", want: true},
+		{value: "", prefix: "us", separators: "-", want: false},
+		{value: "us-central1-a", prefix: "us-central1-a", separators: "-", want: true},
+		{value: "us-central1-a", prefix: "us-central1", separators: "-", want: true},
+		{value: "us-central1-a", prefix: "us", separators: "-", want: true},
+		{value: "us-central1-a", prefix: "us-central", separators: "-", want: false},
+		{value: "us-central1", prefix: "us-central1-a", separators: "-", want: false},
+		{value: "1.27.3-gke.100", prefix: "1.27.3", separators: ".-", want: true},
+		{value: "1.27.3-gke.100", prefix: "1.27.3", separators: ".", want: false},
+		{value: "1.270", prefix: "1.27", separators: ".-", want: false},
+	}
+	for _, tc := range testCases {
+		if got := matchesComponents(tc.value, tc.prefix, tc.separators); got != tc.want {
+			t.Errorf("matchesComponents(%q, %q, %q) = %v, want %v", tc.value, tc.prefix, tc.separators, got, tc.want)
+		}
+	}
+}
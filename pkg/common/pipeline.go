@@ -0,0 +1,96 @@
+package common
+
+import (
+	"runtime"
+	"sync"
+)
+
+// maxPendingPerWorker limits how many clusters can be read ahead of the one
+// being handled, per worker, so that a cluster which is slow to process does
+// not cause the rest of the input to be buffered in memory.
+const maxPendingPerWorker = 4
+
+// ReadParallel reads the clusters from source, and calls process for each of
+// them on parallelism goroutines, or one per CPU if parallelism is less than
+// one.  The values returned by process are passed to handle, and the errors
+// from reading the source or from process are passed to malformed, in the
+// order the clusters were read.  handle and malformed are called from the
+// calling goroutine.  It returns an error only if the input can not be read.
+func ReadParallel(source Source, parallelism int, process func(ClusterOutput) (interface{}, error), handle func(interface{}), malformed func(location string, err error)) error {
+	if parallelism < 1 {
+		parallelism = runtime.NumCPU()
+	}
+	type job struct {
+		index  int
+		output ClusterOutput
+		err    error
+	}
+	type result struct {
+		index    int
+		location string
+		value    interface{}
+		err      error
+	}
+	jobs := make(chan job, parallelism)
+	results := make(chan result, parallelism)
+	pending := make(chan struct{}, maxPendingPerWorker*parallelism)
+
+	var readErr error
+	go func() {
+		defer close(jobs)
+		index := 0
+		send := func(j job) {
+			pending <- struct{}{}
+			j.index = index
+			index++
+			jobs <- j
+		}
+		readErr = source.Read(func(output ClusterOutput) {
+			send(job{output: output})
+		}, func(location string, err error) {
+			send(job{output: ClusterOutput{Location: location}, err: err})
+		})
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				r := result{index: j.index, location: j.output.Location, err: j.err}
+				if r.err == nil {
+					r.value, r.err = process(j.output)
+				}
+				results <- r
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// results arrive in any order, and are held until the ones before them
+	// have been handled
+	done := map[int]result{}
+	next := 0
+	for r := range results {
+		done[r.index] = r
+		for {
+			r, ok := done[next]
+			if !ok {
+				break
+			}
+			delete(done, next)
+			next++
+			if r.err != nil {
+				malformed(r.location, r.err)
+			} else {
+				handle(r.value)
+			}
+			<-pending
+		}
+	}
+	return readErr
+}
@@ -0,0 +1,94 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// logSource is a foreachmaster log held in memory.
+type logSource []byte
+
+func (s logSource) Read(handle func(ClusterOutput), malformed func(location string, err error)) error {
+	return ReadForeachMasterLog(bytes.NewReader(s), handle, malformed)
+}
+
+// syntheticNode is a node record of a synthetic cluster.
+type syntheticNode struct {
+	NodeName    string            `json:"nodeName"`
+	Capacity    map[string]string `json:"capacity"`
+	Allocatable map[string]string `json:"allocatable"`
+	Requests    map[string]string `json:"requests"`
+}
+
+// syntheticLog returns a foreachmaster log of clusters with nodes each, in
+// the scraper's record format.
+func syntheticLog(clusters, nodes int) ([]byte, error) {
+	var log bytes.Buffer
+	for c := 0; c < clusters; c++ {
+		lines := []string{"starting shell script", "Getting Node Allocatable"}
+		for n := 0; n < nodes; n++ {
+			record, err := NewRecord(NodeRecordKind, syntheticNode{
+				NodeName:    fmt.Sprintf("node-%d-%d", c, n),
+				Capacity:    map[string]string{"cpu": "2", "memory": "7Gi", "pods": "110"},
+				Allocatable: map[string]string{"cpu": "1930m", "memory": "5.5Gi", "pods": "110"},
+				Requests:    map[string]string{"cpu": fmt.Sprintf("%dm", 100*n), "memory": "1Gi", "pods": "12"},
+			})
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, record)
+		}
+		fmt.Fprintf(&log, "{\"project\":\"p%d\",\"zone\":\"us-central1-a\",\"cluster\":\"c%d\"} output: %s\n", c%10, c, strconv.Quote(strings.Join(lines, "\n")+"\n"))
+	}
+	return log.Bytes(), nil
+}
+
+func TestReadParallelOrder(t *testing.T) {
+	log, err := syntheticLog(50, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// add truncated clusters, and clusters which fail to process
+	lines := strings.Split(strings.TrimSuffix(string(log), "\n"), "\n")
+	lines = append(lines[:10], append([]string{`{"cluster":"truncated"} output: "a`}, lines[10:]...)...)
+	lines = append(lines, `{"cluster":"unterminated"} output: "`)
+	source := logSource(strings.Join(lines, "\n"))
+	failing := map[string]bool{"line 5": true, "line 30": true}
+
+	var want []string
+	for _, parallelism := range []int{1, 2, 3, 8, 64, 0} {
+		t.Run(fmt.Sprintf("parallelism=%d", parallelism), func(t *testing.T) {
+			got := []string{}
+			err := ReadParallel(source, parallelism, func(output ClusterOutput) (interface{}, error) {
+				// later clusters finish first
+				index, _ := strconv.Atoi(strings.TrimPrefix(output.Location, "line "))
+				time.Sleep(time.Duration(len(lines)-index) * 20 * time.Microsecond)
+				if failing[output.Location] {
+					return nil, errors.New("failed")
+				}
+				return output.Identifier.Raw, nil
+			}, func(value interface{}) {
+				got = append(got, value.(string))
+			}, func(location string, err error) {
+				got = append(got, location+": "+err.Error())
+			})
+			if err != nil {
+				t.Fatalf("ReadParallel() returned error: %v", err)
+			}
+			if len(got) != len(lines) {
+				t.Fatalf("got %d results, want %d", len(got), len(lines))
+			}
+			if want == nil {
+				want = got
+			} else if !reflect.DeepEqual(got, want) {
+				t.Errorf("got results in order %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// ClusterOutput is the input for a single cluster.  It holds either the
+// scraper output, or a snapshot of the cluster's API objects.
+type ClusterOutput struct {
+	// Location is where the output was read from, e.g. a line of a log.
+	Location   string
+	Identifier ClusterIdentifier
+	Lines      []string
+	Snapshot   *Snapshot
+}
+
+// ReadForeachMasterLog reads a foreachmaster log, and calls handle with the
+// output of each cluster.  Lines can be arbitrarily long.  Lines which are not
+// the output of a cluster, such as foreachmaster's own logging, are ignored.
+// The output of clusters which can not be parsed is passed to malformed along
+// with its line number, and skipped.  It returns an error only if the log can
+// not be read.
+func ReadForeachMasterLog(r io.Reader, handle func(ClusterOutput), malformed func(location string, err error)) error {
+	reader := bufio.NewReaderSize(r, 64*1024)
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		line = bytes.TrimRight(line, "\r\n")
+		if isClusterLine(line) {
+			location := fmt.Sprintf("line %d", lineNumber)
+			id, lines, parseErr := ParseForeachMasterLine(line)
+			if parseErr != nil {
+				malformed(location, parseErr)
+			} else {
+				handle(ClusterOutput{
+					Location:   location,
+					Identifier: ParseClusterIdentifier(id),
+					Lines:      lines,
+				})
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// RecordVersion is the version of the record format written by the scrapers.
+// Bump it whenever a change to a record's data is not backwards compatible.
+// Version 2 replaced the CPU and memory fields of node records with lists of
+// all resources.
+const RecordVersion = 2
+
+// Kinds of records written by the scrapers.
+const (
+	NodeRecordKind        = "node"
+	EventRecordKind       = "event"
+	ClusterInfoRecordKind = "clusterInfo"
+	// EventWindowRecordKind holds the period covered by the events scraped
+	// from a cluster.
+	EventWindowRecordKind = "eventWindow"
+)
+
+// Record is a single line of scraper output.  Each record holds one node,
+// event or cluster info object, encoded as JSON in Data.
+type Record struct {
+	Version int             `json:"version"`
+	Kind    string          `json:"kind"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// NewRecord returns the JSON line for a record of the given kind holding data.
+func NewRecord(kind string, data interface{}) (string, error) {
+	blob, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("Unable to encode %s record: %v", kind, err)
+	}
+	line, err := json.Marshal(Record{
+		Version: RecordVersion,
+		Kind:    kind,
+		Data:    blob,
+	})
+	if err != nil {
+		return "", fmt.Errorf("Unable to encode %s record: %v", kind, err)
+	}
+	return string(line), nil
+}
+
+// IsRecord returns true if the line looks like a record rather than one of the
+// legacy, human readable, output formats.
+func IsRecord(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "{")
+}
+
+// ParseRecord decodes a record line.
+func ParseRecord(line string) (*Record, error) {
+	line = strings.TrimSpace(line)
+	record := &Record{}
+	if err := json.Unmarshal([]byte(line), record); err != nil {
+		return nil, fmt.Errorf("Unable to parse record: %s, error: %v", truncate(line), err)
+	}
+	if record.Version < 1 || record.Version > RecordVersion {
+		return nil, fmt.Errorf("Unsupported record version %d, expected at most %d", record.Version, RecordVersion)
+	}
+	return record, nil
+}
+
+// Decode unmarshals the record's data into out.
+func (r *Record) Decode(out interface{}) error {
+	if err := json.Unmarshal(r.Data, out); err != nil {
+		return fmt.Errorf("Unable to decode %s record: %v", r.Kind, err)
+	}
+	return nil
+}
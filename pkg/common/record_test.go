@@ -0,0 +1,92 @@
+package common
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestRecordRoundTrip(t *testing.T) {
+	type data struct {
+		Name  string            `json:"name"`
+		Count int               `json:"count"`
+		Tags  map[string]string `json:"tags"`
+	}
+	in := data{Name: "node \"a\"\n", Count: 3, Tags: map[string]string{"zone": "us-central1-a"}}
+	line, err := NewRecord(NodeRecordKind, in)
+	if err != nil {
+		t.Fatalf("NewRecord() returned error: %v", err)
+	}
+	if !IsRecord(line) {
+		t.Fatalf("IsRecord(%s) = false, want true", line)
+	}
+	record, err := ParseRecord("  " + line + "\r")
+	if err != nil {
+		t.Fatalf("ParseRecord() returned error: %v", err)
+	}
+	if record.Version != RecordVersion || record.Kind != NodeRecordKind {
+		t.Errorf("got version %d and kind %q, want %d and %q", record.Version, record.Kind, RecordVersion, NodeRecordKind)
+	}
+	out := data{}
+	if err := record.Decode(&out); err != nil {
+		t.Fatalf("Decode() returned error: %v", err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("Decode() = %+v, want %+v", out, in)
+	}
+}
+
+func TestNewRecordError(t *testing.T) {
+	if _, err := NewRecord(NodeRecordKind, make(chan int)); err == nil {
+		t.Error("NewRecord() of a channel succeeded, want an error")
+	}
+}
+
+func TestParseRecord(t *testing.T) {
+	testCases := []struct {
+		name    string
+		line    string
+		wantErr bool
+	}{
+		{name: "version 1", line: `{"version":1,"kind":"node","data":{}}`},
+		{name: "current version", line: fmt.Sprintf(`{"version":%d,"kind":"event","data":{}}`, RecordVersion)},
+		{name: "missing version", line: `{"kind":"node","data":{}}`, wantErr: true},
+		{name: "version 0", line: `{"version":0,"kind":"node","data":{}}`, wantErr: true},
+		{name: "negative version", line: `{"version":-1,"kind":"node","data":{}}`, wantErr: true},
+		{name: "future version", line: fmt.Sprintf(`{"version":%d,"kind":"node","data":{}}`, RecordVersion+1), wantErr: true},
+		{name: "not JSON", line: `{version: 1}`, wantErr: true},
+		{name: "truncated", line: `{"version":1,"kind":"node","data":{`, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			record, err := ParseRecord(tc.line)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("ParseRecord() = %+v, want an error", record)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRecord() returned error: %v", err)
+			}
+		})
+	}
+}
+
+func TestIsRecord(t *testing.T) {
+	testCases := []struct {
+		line string
+		want bool
+	}{
+		{line: `{"version":2,"kind":"node","data":{}}`, want: true},
+		{line: `  {"version":2}`, want: true},
+		{line: "NodeName: a, Memory: 1Gi / 2Gi = 50%, CPU: 1 / 2 = 50%", want: false},
+		{line: "Getting Node Allocatable", want: false},
+		{line: "", want: false},
+	}
+	for _, tc := range testCases {
+		if got := IsRecord(tc.line); got != tc.want {
+			t.Errorf("IsRecord(%q) = %v, want %v", tc.line, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,400 @@
+package common
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"k8s.io/api/core/v1"
+)
+
+// Kinds of input sources the processors can read.
+const (
+	// ForeachMasterSource is a foreachmaster log, with one line per cluster.
+	ForeachMasterSource = "foreachmaster"
+	// DirectorySource is a directory with one file of scraper output per
+	// cluster.
+	DirectorySource = "dir"
+	// KubectlSource is a directory of `kubectl get -o json` dumps.
+	KubectlSource = "kubectl"
+	// StdinSource is the scraper output of a single cluster, read from stdin.
+	StdinSource = "stdin"
+	// TarballSource is a tar archive, optionally gzipped, of directories of
+	// `kubectl get -o json` dumps.
+	TarballSource = "tarball"
+)
+
+// Files of a kubectl snapshot, holding the output of
+// `kubectl get nodes|pods|events --all-namespaces -o json`.
+const (
+	NodesFile  = "nodes.json"
+	PodsFile   = "pods.json"
+	EventsFile = "events.json"
+)
+
+// Snapshot holds the API objects of a single cluster.
+type Snapshot struct {
+	Nodes  []v1.Node
+	Pods   []v1.Pod
+	Events []v1.Event
+}
+
+// Source is the input of the processors, holding the output of one or more
+// clusters.
+type Source interface {
+	// Read calls handle with the output of each cluster.  Input which can not
+	// be parsed is passed to malformed along with its location, and skipped.
+	// It returns an error only if the input can not be read.
+	Read(handle func(ClusterOutput), malformed func(location string, err error)) error
+}
+
+// NewSource returns the source of the given kind, reading from path.  The
+// path is ignored for stdin.
+func NewSource(kind, path string) (Source, error) {
+	switch kind {
+	case ForeachMasterSource:
+		return &foreachMasterSource{path: path}, nil
+	case DirectorySource:
+		return &directorySource{path: path}, nil
+	case KubectlSource:
+		return &kubectlSource{path: path}, nil
+	case StdinSource:
+		return &stdinSource{r: os.Stdin}, nil
+	case TarballSource:
+		return &tarballSource{path: path}, nil
+	}
+	return nil, fmt.Errorf("Unknown source %s, must be %s, %s, %s, %s or %s", kind, ForeachMasterSource, DirectorySource, KubectlSource, StdinSource, TarballSource)
+}
+
+type foreachMasterSource struct {
+	path string
+}
+
+func (s *foreachMasterSource) Read(handle func(ClusterOutput), malformed func(location string, err error)) error {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return ReadForeachMasterLog(file, handle, malformed)
+}
+
+// directorySource reads each file in a directory as the output of one
+// cluster.  The file name, without its extension, is the cluster identifier,
+// e.g. project=p,location=us-central1-a,name=c.log.
+type directorySource struct {
+	path string
+}
+
+func (s *directorySource) Read(handle func(ClusterOutput), malformed func(location string, err error)) error {
+	entries, err := os.ReadDir(s.path)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		filename := filepath.Join(s.path, entry.Name())
+		file, err := os.Open(filename)
+		if err != nil {
+			malformed(filename, err)
+			continue
+		}
+		lines, err := readLines(file)
+		file.Close()
+		if err != nil {
+			malformed(filename, err)
+			continue
+		}
+		handle(ClusterOutput{
+			Location:   filename,
+			Identifier: ParseClusterIdentifier(strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))),
+			Lines:      lines,
+		})
+	}
+	return nil
+}
+
+// stdinSource reads the output of a single cluster from r, which is stdin
+// outside of tests.
+type stdinSource struct {
+	r io.Reader
+}
+
+func (s *stdinSource) Read(handle func(ClusterOutput), malformed func(location string, err error)) error {
+	lines, err := readLines(s.r)
+	if err != nil {
+		return err
+	}
+	handle(ClusterOutput{
+		Location:   StdinSource,
+		Identifier: ParseClusterIdentifier(StdinSource),
+		Lines:      lines,
+	})
+	return nil
+}
+
+// kubectlSource reads kubectl dumps.  If the directory holds a nodes.json
+// file, it is a single cluster.  Otherwise, each of its subdirectories is a
+// cluster, identified by the name of the subdirectory.  Missing pods and
+// events files are treated as empty.
+type kubectlSource struct {
+	path string
+}
+
+func (s *kubectlSource) Read(handle func(ClusterOutput), malformed func(location string, err error)) error {
+	if _, err := os.Stat(filepath.Join(s.path, NodesFile)); err == nil {
+		s.readCluster(s.path, handle, malformed)
+		return nil
+	}
+	entries, err := os.ReadDir(s.path)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			s.readCluster(filepath.Join(s.path, entry.Name()), handle, malformed)
+		}
+	}
+	return nil
+}
+
+func (s *kubectlSource) readCluster(dir string, handle func(ClusterOutput), malformed func(location string, err error)) {
+	snapshot := &Snapshot{}
+	for _, kind := range []string{NodesFile, PodsFile, EventsFile} {
+		filename := filepath.Join(dir, kind)
+		if err := readSnapshotFile(filename, kind, snapshot); err != nil {
+			if !os.IsNotExist(err) || kind == NodesFile {
+				malformed(filename, err)
+				return
+			}
+		}
+	}
+	handle(ClusterOutput{
+		Location:   dir,
+		Identifier: ParseClusterIdentifier(filepath.Base(dir)),
+		Snapshot:   snapshot,
+	})
+}
+
+// NewSnapshotSource returns a source holding a single cluster, read from
+// kubectl dumps of its nodes, pods and events.  The pods and events files are
+// optional.
+func NewSnapshotSource(nodesFile, podsFile, eventsFile string) Source {
+	return &snapshotSource{files: map[string]string{
+		NodesFile:  nodesFile,
+		PodsFile:   podsFile,
+		EventsFile: eventsFile,
+	}}
+}
+
+type snapshotSource struct {
+	// files maps the kind of each file to its path
+	files map[string]string
+}
+
+func (s *snapshotSource) Read(handle func(ClusterOutput), malformed func(location string, err error)) error {
+	snapshot := &Snapshot{}
+	for _, kind := range []string{NodesFile, PodsFile, EventsFile} {
+		if s.files[kind] == "" {
+			continue
+		}
+		if err := readSnapshotFile(s.files[kind], kind, snapshot); err != nil {
+			return err
+		}
+	}
+	nodesFile := s.files[NodesFile]
+	handle(ClusterOutput{
+		Location:   nodesFile,
+		Identifier: ParseClusterIdentifier(filepath.Base(filepath.Dir(nodesFile))),
+		Snapshot:   snapshot,
+	})
+	return nil
+}
+
+// NewCachedSource returns a source which reads source once, on the first call
+// to Read, and replays the clusters and malformed input it found on every
+// later call.  This lets several analyses share one pass over the input, at
+// the cost of holding it in memory.
+func NewCachedSource(source Source) Source {
+	return &cachedSource{source: source}
+}
+
+type cachedSource struct {
+	source Source
+	read   bool
+	err    error
+	// entries are the clusters and malformed input, in the order they were
+	// read
+	entries []cachedEntry
+}
+
+// cachedEntry is either the output of a cluster, or malformed input.
+type cachedEntry struct {
+	output   *ClusterOutput
+	location string
+	err      error
+}
+
+func (s *cachedSource) Read(handle func(ClusterOutput), malformed func(location string, err error)) error {
+	if !s.read {
+		s.read = true
+		s.err = s.source.Read(func(output ClusterOutput) {
+			s.entries = append(s.entries, cachedEntry{output: &output})
+		}, func(location string, err error) {
+			s.entries = append(s.entries, cachedEntry{location: location, err: err})
+		})
+	}
+	for _, entry := range s.entries {
+		if entry.output != nil {
+			handle(*entry.output)
+		} else {
+			malformed(entry.location, entry.err)
+		}
+	}
+	return s.err
+}
+
+// tarballSource reads kubectl dumps from a tar archive, which may be gzipped.
+// Each directory in the archive holding a nodes.json file is a cluster,
+// identified by the name of the directory.
+type tarballSource struct {
+	path string
+}
+
+func (s *tarballSource) Read(handle func(ClusterOutput), malformed func(location string, err error)) error {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var r io.Reader = file
+	if strings.HasSuffix(s.path, ".gz") || strings.HasSuffix(s.path, ".tgz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	// the files of a cluster are not necessarily adjacent in the archive
+	snapshots := map[string]*Snapshot{}
+	hasNodes := map[string]bool{}
+	tarReader := tar.NewReader(r)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		kind := path.Base(header.Name)
+		if header.Typeflag != tar.TypeReg || (kind != NodesFile && kind != PodsFile && kind != EventsFile) {
+			continue
+		}
+		dir := path.Dir(header.Name)
+		if snapshots[dir] == nil {
+			snapshots[dir] = &Snapshot{}
+		}
+		if err := decodeSnapshotFile(tarReader, kind, snapshots[dir]); err != nil {
+			malformed(s.path+":"+header.Name, err)
+			continue
+		}
+		if kind == NodesFile {
+			hasNodes[dir] = true
+		}
+	}
+	dirs := []string{}
+	for dir := range snapshots {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		location := s.path + ":" + dir
+		if !hasNodes[dir] {
+			malformed(location, fmt.Errorf("Unable to find %s", NodesFile))
+			continue
+		}
+		name := path.Base(dir)
+		if dir == "." {
+			name = strings.TrimSuffix(strings.TrimSuffix(filepath.Base(s.path), filepath.Ext(s.path)), ".tar")
+		}
+		handle(ClusterOutput{
+			Location:   location,
+			Identifier: ParseClusterIdentifier(name),
+			Snapshot:   snapshots[dir],
+		})
+	}
+	return nil
+}
+
+// readSnapshotFile decodes the kubectl dump in filename, which holds objects
+// of the given kind, into the snapshot.
+func readSnapshotFile(filename, kind string, snapshot *Snapshot) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := decodeSnapshotFile(file, kind, snapshot); err != nil {
+		return fmt.Errorf("Unable to decode %s: %v", filename, err)
+	}
+	return nil
+}
+
+// decodeSnapshotFile decodes a kubectl dump, which holds objects of the given
+// kind, into the snapshot.
+func decodeSnapshotFile(r io.Reader, kind string, snapshot *Snapshot) error {
+	decoder := json.NewDecoder(r)
+	switch kind {
+	case NodesFile:
+		list := v1.NodeList{}
+		if err := decoder.Decode(&list); err != nil {
+			return err
+		}
+		snapshot.Nodes = list.Items
+	case PodsFile:
+		list := v1.PodList{}
+		if err := decoder.Decode(&list); err != nil {
+			return err
+		}
+		snapshot.Pods = list.Items
+	case EventsFile:
+		list := v1.EventList{}
+		if err := decoder.Decode(&list); err != nil {
+			return err
+		}
+		snapshot.Events = list.Items
+	}
+	return nil
+}
+
+// readLines returns the lines of r, without line endings.  Lines can be
+// arbitrarily long.
+func readLines(r io.Reader) ([]string, error) {
+	lines := []string{}
+	reader := bufio.NewReaderSize(r, 64*1024)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			lines = append(lines, string(bytes.TrimRight(line, "\r\n")))
+		}
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
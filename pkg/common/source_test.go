@@ -0,0 +1,319 @@
+package common
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeSource returns its outputs and malformed input, and counts its reads.
+type fakeSource struct {
+	reads int
+	err   error
+}
+
+func (s *fakeSource) Read(handle func(ClusterOutput), malformed func(location string, err error)) error {
+	s.reads++
+	handle(ClusterOutput{Location: "a", Snapshot: &Snapshot{}})
+	malformed("b", errors.New("bad"))
+	handle(ClusterOutput{Location: "c", Lines: []string{"line"}})
+	return s.err
+}
+
+func TestCachedSource(t *testing.T) {
+	readErr := errors.New("truncated")
+	underlying := &fakeSource{err: readErr}
+	source := NewCachedSource(underlying)
+	var firstSnapshot *Snapshot
+	for i := 0; i < 3; i++ {
+		read := []string{}
+		err := source.Read(func(output ClusterOutput) {
+			read = append(read, output.Location)
+			if output.Snapshot != nil {
+				if firstSnapshot == nil {
+					firstSnapshot = output.Snapshot
+				} else if output.Snapshot != firstSnapshot {
+					t.Errorf("read %d decoded the snapshot again", i)
+				}
+			}
+		}, func(location string, err error) {
+			read = append(read, "malformed "+location)
+		})
+		if err != readErr {
+			t.Errorf("read %d returned error %v, want %v", i, err, readErr)
+		}
+		if want := []string{"a", "malformed b", "c"}; !reflect.DeepEqual(read, want) {
+			t.Errorf("read %d got %q, want %q", i, read, want)
+		}
+	}
+	if underlying.reads != 1 {
+		t.Errorf("the underlying source was read %d times, want once", underlying.reads)
+	}
+}
+
+// readSource returns the clusters read from the source, and the locations of
+// its malformed input.
+func readSource(t *testing.T, source Source) ([]ClusterOutput, []string, error) {
+	t.Helper()
+	outputs := []ClusterOutput{}
+	malformed := []string{}
+	err := source.Read(func(output ClusterOutput) {
+		outputs = append(outputs, output)
+	}, func(location string, err error) {
+		malformed = append(malformed, location)
+	})
+	return outputs, malformed, err
+}
+
+func writeFile(t *testing.T, filename, contents string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filename, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// nodeList returns a kubectl dump of nodes with the given names.
+func nodeList(t *testing.T, names ...string) string {
+	t.Helper()
+	list := v1.NodeList{}
+	for _, name := range names {
+		list.Items = append(list.Items, v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+	blob, err := json.Marshal(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(blob)
+}
+
+func podList(t *testing.T, names ...string) string {
+	t.Helper()
+	list := v1.PodList{}
+	for _, name := range names {
+		list.Items = append(list.Items, v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+	blob, err := json.Marshal(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(blob)
+}
+
+func TestNewSource(t *testing.T) {
+	for _, kind := range []string{ForeachMasterSource, DirectorySource, KubectlSource, StdinSource, TarballSource} {
+		if _, err := NewSource(kind, "path"); err != nil {
+			t.Errorf("NewSource(%s) returned error: %v", kind, err)
+		}
+	}
+	if _, err := NewSource("gcs", "path"); err == nil {
+		t.Error("NewSource(gcs) succeeded, want an error")
+	}
+}
+
+func TestDirectorySource(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "project=p,location=us-central1-a,name=a.log"), "first\r\nsecond\n")
+	writeFile(t, filepath.Join(dir, "b"), "only")
+	writeFile(t, filepath.Join(dir, ".hidden"), "skipped")
+	writeFile(t, filepath.Join(dir, "subdir", "c.log"), "skipped")
+	if err := os.Symlink(filepath.Join(dir, "missing"), filepath.Join(dir, "dangling.log")); err != nil {
+		t.Fatal(err)
+	}
+
+	outputs, malformed, err := readSource(t, &directorySource{path: dir})
+	if err != nil {
+		t.Fatalf("Read() returned error: %v", err)
+	}
+	if len(outputs) != 2 {
+		t.Fatalf("got %d clusters, want 2", len(outputs))
+	}
+	want := ClusterIdentifier{Project: "p", Location: "us-central1-a", Name: "a", Raw: "project=p,location=us-central1-a,name=a"}
+	if outputs[1].Identifier != want {
+		t.Errorf("got identifier %+v, want %+v", outputs[1].Identifier, want)
+	}
+	if !reflect.DeepEqual(outputs[1].Lines, []string{"first", "second"}) {
+		t.Errorf("got lines %q, want first and second", outputs[1].Lines)
+	}
+	if outputs[0].Identifier.Raw != "b" || !reflect.DeepEqual(outputs[0].Lines, []string{"only"}) {
+		t.Errorf("got %+v, want cluster b with one line", outputs[0])
+	}
+	if want := []string{filepath.Join(dir, "dangling.log")}; !reflect.DeepEqual(malformed, want) {
+		t.Errorf("got malformed %q, want %q", malformed, want)
+	}
+
+	if _, _, err := readSource(t, &directorySource{path: filepath.Join(dir, "missing")}); err == nil {
+		t.Error("Read() of a missing directory succeeded, want an error")
+	}
+}
+
+func TestStdinSource(t *testing.T) {
+	outputs, malformed, err := readSource(t, &stdinSource{r: strings.NewReader("first\r\n\nthird")})
+	if err != nil {
+		t.Fatalf("Read() returned error: %v", err)
+	}
+	if len(outputs) != 1 || len(malformed) != 0 {
+		t.Fatalf("got %d clusters and %d malformed, want one cluster", len(outputs), len(malformed))
+	}
+	if outputs[0].Location != StdinSource || outputs[0].Identifier.Raw != StdinSource {
+		t.Errorf("got location %s and identifier %+v, want %s", outputs[0].Location, outputs[0].Identifier, StdinSource)
+	}
+	if want := []string{"first", "", "third"}; !reflect.DeepEqual(outputs[0].Lines, want) {
+		t.Errorf("got lines %q, want %q", outputs[0].Lines, want)
+	}
+
+	readErr := errors.New("closed")
+	outputs, _, err = readSource(t, &stdinSource{r: iotest.ErrReader(readErr)})
+	if err != readErr || len(outputs) != 0 {
+		t.Errorf("Read() = %d clusters, %v, want none and %v", len(outputs), err, readErr)
+	}
+}
+
+func TestKubectlSource(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a", NodesFile), nodeList(t, "n1", "n2"))
+	writeFile(t, filepath.Join(dir, "a", PodsFile), podList(t, "p1"))
+	writeFile(t, filepath.Join(dir, "b", PodsFile), podList(t, "p1"))
+	writeFile(t, filepath.Join(dir, "c", NodesFile), nodeList(t, "n1"))
+	writeFile(t, filepath.Join(dir, "c", PodsFile), "{not json")
+	writeFile(t, filepath.Join(dir, ".d", NodesFile), nodeList(t, "n1"))
+	writeFile(t, filepath.Join(dir, "notes.txt"), "skipped")
+
+	outputs, malformed, err := readSource(t, &kubectlSource{path: dir})
+	if err != nil {
+		t.Fatalf("Read() returned error: %v", err)
+	}
+	if len(outputs) != 1 {
+		t.Fatalf("got %d clusters, want 1", len(outputs))
+	}
+	if outputs[0].Identifier.Raw != "a" || len(outputs[0].Snapshot.Nodes) != 2 || len(outputs[0].Snapshot.Pods) != 1 || len(outputs[0].Snapshot.Events) != 0 {
+		t.Errorf("got cluster %s with %d nodes, %d pods and %d events, want a with 2 nodes and 1 pod",
+			outputs[0].Identifier.Raw, len(outputs[0].Snapshot.Nodes), len(outputs[0].Snapshot.Pods), len(outputs[0].Snapshot.Events))
+	}
+	if want := []string{filepath.Join(dir, "b", NodesFile), filepath.Join(dir, "c", PodsFile)}; !reflect.DeepEqual(malformed, want) {
+		t.Errorf("got malformed %q, want %q", malformed, want)
+	}
+
+	// a directory holding nodes.json is a single cluster
+	outputs, malformed, err = readSource(t, &kubectlSource{path: filepath.Join(dir, "a")})
+	if err != nil || len(outputs) != 1 || len(malformed) != 0 || outputs[0].Identifier.Raw != "a" {
+		t.Errorf("Read() of a single cluster = %+v, %q, %v, want cluster a", outputs, malformed, err)
+	}
+
+	if _, _, err := readSource(t, &kubectlSource{path: filepath.Join(dir, "missing")}); err == nil {
+		t.Error("Read() of a missing directory succeeded, want an error")
+	}
+}
+
+// writeTarball writes the files to a tar archive, which is gzipped if the
+// filename ends in .gz or .tgz.
+func writeTarball(t *testing.T, filename string, files [][2]string) {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var gz *gzip.Writer
+	if strings.HasSuffix(filename, ".gz") || strings.HasSuffix(filename, ".tgz") {
+		gz = gzip.NewWriter(&buf)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	for _, file := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: file[0], Mode: 0644, Size: int64(len(file[1])), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(file[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, filename, buf.String())
+}
+
+func TestTarballSource(t *testing.T) {
+	dir := t.TempDir()
+	files := [][2]string{
+		{"snapshots/b/" + NodesFile, nodeList(t, "n1")},
+		{"snapshots/a/" + PodsFile, podList(t, "p1", "p2")},
+		{"snapshots/c/" + PodsFile, podList(t, "p1")},
+		{"snapshots/d/" + NodesFile, "{not json"},
+		{"snapshots/a/README", "skipped"},
+		{"snapshots/a/" + NodesFile, nodeList(t, "n1", "n2")},
+	}
+	for _, name := range []string{"snapshots.tar", "snapshots.tgz"} {
+		t.Run(name, func(t *testing.T) {
+			filename := filepath.Join(dir, name)
+			writeTarball(t, filename, files)
+			outputs, malformed, err := readSource(t, &tarballSource{path: filename})
+			if err != nil {
+				t.Fatalf("Read() returned error: %v", err)
+			}
+			clusters := []string{}
+			for _, output := range outputs {
+				clusters = append(clusters, output.Identifier.Raw)
+			}
+			if want := []string{"a", "b"}; !reflect.DeepEqual(clusters, want) {
+				t.Fatalf("got clusters %q, want %q", clusters, want)
+			}
+			if len(outputs[0].Snapshot.Nodes) != 2 || len(outputs[0].Snapshot.Pods) != 2 {
+				t.Errorf("got %d nodes and %d pods in a, want 2 of each", len(outputs[0].Snapshot.Nodes), len(outputs[0].Snapshot.Pods))
+			}
+			want := []string{
+				filename + ":snapshots/d/" + NodesFile,
+				filename + ":snapshots/c",
+				filename + ":snapshots/d",
+			}
+			if !reflect.DeepEqual(malformed, want) {
+				t.Errorf("got malformed %q, want %q", malformed, want)
+			}
+		})
+	}
+
+	t.Run("single cluster", func(t *testing.T) {
+		filename := filepath.Join(dir, "project=p,name=c.tar.gz")
+		writeTarball(t, filename, [][2]string{{NodesFile, nodeList(t, "n1")}})
+		outputs, malformed, err := readSource(t, &tarballSource{path: filename})
+		if err != nil || len(outputs) != 1 || len(malformed) != 0 {
+			t.Fatalf("Read() = %d clusters, %q, %v, want one cluster", len(outputs), malformed, err)
+		}
+		if want := (ClusterIdentifier{Project: "p", Name: "c", Raw: "project=p,name=c"}); outputs[0].Identifier != want {
+			t.Errorf("got identifier %+v, want %+v", outputs[0].Identifier, want)
+		}
+	})
+
+	for name, contents := range map[string]string{
+		"corrupt.tar": strings.Repeat("not a tarball ", 100),
+		"corrupt.tgz": "not gzipped",
+	} {
+		t.Run(name, func(t *testing.T) {
+			filename := filepath.Join(dir, name)
+			writeFile(t, filename, contents)
+			if _, _, err := readSource(t, &tarballSource{path: filename}); err == nil {
+				t.Error("Read() succeeded, want an error")
+			}
+		})
+	}
+	if _, _, err := readSource(t, &tarballSource{path: filepath.Join(dir, "missing.tar")}); err == nil {
+		t.Error("Read() of a missing file succeeded, want an error")
+	}
+}
@@ -0,0 +1,152 @@
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/dashpole/allocatable/pkg/common"
+	"github.com/dashpole/allocatable/pkg/events/types"
+)
+
+// Options configure the events analysis.
+type Options struct {
+	// Output is the path of the CSV of cluster events.
+	Output string
+	// Filter selects the clusters to process.
+	Filter common.ClusterFilter
+	// Reasons are the reasons of the events to process, one column each.
+	Reasons types.Reasons
+	// Parallelism is the number of clusters processed at once, or one per CPU
+	// if it is less than one.
+	Parallelism int
+	// Diagnostics, if set, is the path to write the problems found in the
+	// input to, as JSON.
+	Diagnostics string
+	// Breakdown, if set, is the path to write the number of events per node,
+	// namespace and workload of each cluster to, as CSV.
+	Breakdown string
+	// Evictions, if set, is the path to write the eviction stats per starved
+	// resource of each cluster to, as CSV.
+	Evictions string
+	// OOMs, if set, is the path to write the number of OOM kills per kind
+	// and process of each cluster to, as CSV.
+	OOMs string
+}
+
+// clusterResult holds the row for a cluster, along with its problems.
+type clusterResult struct {
+	data          []string
+	breakdownRows [][]string
+	evictionRows  [][]string
+	oomRows       [][]string
+	status        string
+	problems      []common.Problem
+}
+
+// Run processes the events of the clusters read from source, and writes the
+// results.  Clusters which can not be parsed are skipped, and recorded in the
+// returned diagnostics.  It returns an error if the input can not be read,
+// or the results can not be written.
+func Run(source common.Source, opts Options) (*common.Diagnostics, error) {
+	header := append(common.GetClusterIdentifierHeader(), "Status")
+	data := [][]string{append(header, types.GetClusterEventsHeader(opts.Reasons)...)}
+	breakdownRows := [][]string{append(common.GetClusterIdentifierHeader(), types.GetBreakdownHeader()...)}
+	evictionRows := [][]string{append(common.GetClusterIdentifierHeader(), types.GetEvictionHeader()...)}
+	oomRows := [][]string{append(common.GetClusterIdentifierHeader(), types.GetOOMHeader()...)}
+	diagnostics := common.NewDiagnostics()
+	process := func(output common.ClusterOutput) (interface{}, error) {
+		if !opts.Filter.Matches(output.Identifier) {
+			return nil, nil
+		}
+		result := &clusterResult{problems: []common.Problem{}}
+		clusterEvents, err := types.GetClusterEvents(output, opts.Reasons)
+		missingClusterInfo := errors.Is(err, types.ErrMissingClusterInfo)
+		if err != nil && !missingClusterInfo {
+			return nil, err
+		}
+		failures := common.GetFailures(output.Lines)
+		for _, failure := range failures {
+			result.problems = append(result.problems, common.Problem{
+				Kind:     common.ScrapeErrorProblem,
+				Location: output.Location,
+				Cluster:  output.Identifier.Raw,
+				Message:  failure.String(),
+			})
+		}
+		result.status = common.GetStatus(!missingClusterInfo, failures)
+		result.data = append(output.Identifier.ToSlice(), result.status)
+		if missingClusterInfo {
+			// the columns of failed clusters are left empty, so every row
+			// has the same columns
+			result.data = append(result.data, make([]string, len(types.GetClusterEventsHeader(opts.Reasons)))...)
+			// failed clusters are included, so coverage can be measured
+			result.problems = append(result.problems, common.Problem{
+				Kind:     common.MissingClusterInfoProblem,
+				Location: output.Location,
+				Cluster:  output.Identifier.Raw,
+				Message:  err.Error(),
+			})
+			return result, nil
+		}
+		result.data = append(result.data, clusterEvents.ToSlice()...)
+		for _, row := range clusterEvents.Breakdown.ToRows(clusterEvents.Window.Days()) {
+			result.breakdownRows = append(result.breakdownRows, append(output.Identifier.ToSlice(), row...))
+		}
+		for _, row := range clusterEvents.Evictions.ToRows() {
+			result.evictionRows = append(result.evictionRows, append(output.Identifier.ToSlice(), row...))
+		}
+		for _, row := range clusterEvents.OOMs.ToRows() {
+			result.oomRows = append(result.oomRows, append(output.Identifier.ToSlice(), row...))
+		}
+		return result, nil
+	}
+	handle := func(value interface{}) {
+		result, ok := value.(*clusterResult)
+		if !ok {
+			return
+		}
+		diagnostics.AddCluster(result.status, result.problems...)
+		data = append(data, result.data)
+		breakdownRows = append(breakdownRows, result.breakdownRows...)
+		evictionRows = append(evictionRows, result.evictionRows...)
+		oomRows = append(oomRows, result.oomRows...)
+	}
+	skip := func(location string, err error) {
+		fmt.Fprintf(os.Stderr, "Skipping %s: %v\n", location, err)
+		diagnostics.AddCluster(common.FailedStatus, common.Problem{
+			Kind:     common.UnparseableProblem,
+			Location: location,
+			Message:  err.Error(),
+		})
+	}
+	err := common.ReadParallel(source, opts.Parallelism, process, handle, skip)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading input: %v", err)
+	}
+
+	if err := common.ToCSV(opts.Output, data); err != nil {
+		return diagnostics, fmt.Errorf("Error writing output to csv: %v", err)
+	}
+	if opts.Breakdown != "" {
+		if err := common.ToCSV(opts.Breakdown, breakdownRows); err != nil {
+			return diagnostics, fmt.Errorf("Error writing breakdown: %v", err)
+		}
+	}
+	if opts.Evictions != "" {
+		if err := common.ToCSV(opts.Evictions, evictionRows); err != nil {
+			return diagnostics, fmt.Errorf("Error writing eviction stats: %v", err)
+		}
+	}
+	if opts.OOMs != "" {
+		if err := common.ToCSV(opts.OOMs, oomRows); err != nil {
+			return diagnostics, fmt.Errorf("Error writing OOM stats: %v", err)
+		}
+	}
+	if opts.Diagnostics != "" {
+		if err := diagnostics.Write(opts.Diagnostics); err != nil {
+			return diagnostics, fmt.Errorf("Error writing diagnostics: %v", err)
+		}
+	}
+	return diagnostics, nil
+}
@@ -1,65 +1,61 @@
 package main
 
 import (
-	"bufio"
 	"flag"
 	"fmt"
-	"io"
 	"os"
-	"strings"
 
 	"github.com/dashpole/allocatable/pkg/common"
+	"github.com/dashpole/allocatable/pkg/events/analysis"
 	"github.com/dashpole/allocatable/pkg/events/types"
 )
 
-var path = flag.String("path", "foreachmaster.log", "path to your log file")
+var sourceKind = flag.String("source", common.ForeachMasterSource, "kind of input, one of foreachmaster (a foreachmaster log), dir (a directory with one file of scraper output per cluster), kubectl (a directory of kubectl get -o json dumps), tarball (a tarball of kubectl dumps) or stdin (the scraper output of a single cluster)")
+var path = flag.String("path", "foreachmaster.log", "path to your log file, or directory for the dir and kubectl sources, or tarball")
 var outputFile = flag.String("output", "_output/eventStats.csv", "path to output file")
+var breakdownFile = flag.String("breakdown", "_output/eventBreakdown.csv", "path to write the number of events per node, namespace and workload of each cluster to; if empty, it is not written")
+var evictionsFile = flag.String("evictions", "_output/evictionStats.csv", "path to write the eviction stats per starved resource of each cluster to; if empty, they are not written")
+var oomsFile = flag.String("ooms", "_output/oomStats.csv", "path to write the number of container and system OOM kills per process of each cluster to; if empty, they are not written")
+var reasons = flag.String("reasons", types.DefaultProfile, "comma separated list of the event reasons to process, or of the profiles disruptive (Evicted, OOMKilling, SystemOOM), scheduling, node-health and crashes; the output has one column per reason")
+var project = flag.String("project", "", "if set, only process clusters in this project")
+var location = flag.String("location", "", "if set, only process clusters in this region or zone")
+var masterVersion = flag.String("master-version", "", "if set, only process clusters whose master version starts with this version, e.g. 1.27")
+var diagnosticsFile = flag.String("diagnostics", "_output/eventDiagnostics.json", "path to write the problems found in the input to, as JSON; if empty, they are not written")
+var maxFailureRate = flag.Float64("max-failure-rate", common.DefaultMaxFailureRate, "exit with a non-zero status if more than this fraction of clusters could not be processed")
+var parallelism = flag.Int("parallelism", 0, "number of clusters to process at once; if 0, one per CPU")
 
 func main() {
 	flag.Parse()
-	file, err := os.Open(*path)
+	eventReasons, err := types.ParseReasons(*reasons)
 	if err != nil {
-		fmt.Printf("Error opening file: %v", err)
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(common.FatalExitCode)
 	}
-	defer file.Close()
-
-	data := [][]string{}
-	r := bufio.NewReaderSize(file, 512*1024)
-	line, bufferToSmall, err := r.ReadLine()
-	for err == nil && !bufferToSmall {
-		_, clusterLines, parseErr := common.ParseForeachMasterLine(line)
-		if parseErr == nil {
-			/*
-				Lines are as follows:
-				0: "starting shell script"
-				1: "Getting Events"
-				2...n-4: Events
-				n-3: "Getting ClusterInfo"
-				n-2: ClusterInfo
-				n-1:
-			*/
-			clusterData := []string{}
-			clusterInfo, parseErr := types.ParseClusterInfo(clusterLines[len(clusterLines)-2])
-			if parseErr == nil {
-				clusterData = append(clusterData, clusterInfo.ToSlice()...)
-				eventList := types.ParseDisruptiveEventList(strings.Join(clusterLines[2:len(clusterLines)-3], ""))
-				clusterData = append(clusterData, eventList.ToSlice()...)
-				data = append(data, clusterData)
-			}
-		}
-		line, bufferToSmall, err = r.ReadLine()
-	}
-	if bufferToSmall {
-		fmt.Println("buffer size to small")
-		return
-	}
-	if err != io.EOF {
-		fmt.Println(err)
-		return
+	source, err := common.NewSource(*sourceKind, *path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening input: %v\n", err)
+		os.Exit(common.FatalExitCode)
 	}
-
-	err = common.ToCSV(*outputFile, data)
+	diagnostics, err := analysis.Run(source, analysis.Options{
+		Output:  *outputFile,
+		Reasons: eventReasons,
+		Filter: common.ClusterFilter{
+			Project:       *project,
+			Location:      *location,
+			MasterVersion: *masterVersion,
+		},
+		Parallelism: *parallelism,
+		Diagnostics: *diagnosticsFile,
+		Breakdown:   *breakdownFile,
+		Evictions:   *evictionsFile,
+		OOMs:        *oomsFile,
+	})
 	if err != nil {
-		fmt.Printf("Error writing output to csv: %v\n", err)
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(common.FatalExitCode)
+	}
+	if diagnostics.ExceedsFailureRate(*maxFailureRate) {
+		fmt.Fprintf(os.Stderr, "Unable to process %d of %d clusters, which exceeds the maximum failure rate of %v\n", diagnostics.FailedClusters, diagnostics.Clusters, *maxFailureRate)
+		os.Exit(common.FailureRateExitCode)
 	}
 }
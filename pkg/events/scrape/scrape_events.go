@@ -1,71 +1,159 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"flag"
 	"fmt"
-	"os/exec"
+	"os"
 	"time"
 
+	"github.com/dashpole/allocatable/pkg/collector"
+	"github.com/dashpole/allocatable/pkg/common"
 	"github.com/dashpole/allocatable/pkg/events/types"
-	"k8s.io/api/core/v1"
 )
 
-const retryNumber = 2
+var masterURL = flag.String("master", "", "address of the kubernetes API server; overrides any value in kubeconfig")
+var kubeconfig = flag.String("kubeconfig", "", "path to a kubeconfig; if empty, the default kubeconfig or in-cluster config is used")
+var outputFormat = flag.String("output-format", "json", "format of the scraped output, either json (one record per line) or legacy")
+var since = flag.String("since", os.Getenv("EVENTS_SINCE"), "only get events which occurred after this time, either a duration before now, e.g. 24h, or an RFC3339 time; if empty, all events the API server retains are returned (env EVENTS_SINCE)")
+var until = flag.String("until", os.Getenv("EVENTS_UNTIL"), "only get events which occurred before this time, either a duration before now or an RFC3339 time; if empty, events up to now are returned (env EVENTS_UNTIL)")
+var reasons = flag.String("reasons", getEnv("EVENTS_REASONS", types.DefaultProfile), "comma separated list of the event reasons to get, or of the profiles disruptive (Evicted, OOMKilling, SystemOOM), scheduling, node-health and crashes (env EVENTS_REASONS)")
+var retryPolicy = collector.RegisterRetryFlags()
 
 func main() {
+	flag.Parse()
 	fmt.Println("Getting Events")
-	for i := 0; i < retryNumber; i++ {
-		events, err := fetchEvents()
-		if err == nil {
-			fmt.Println(events.String())
-			break
-		}
-		fmt.Printf("Error getting Events: %v\n", err)
-		if i < retryNumber-1 {
-			fmt.Printf("Retrying fetchEvents...")
-		}
-		time.Sleep(1 * time.Minute)
+	window, err := types.ParseWindow(*since, *until, time.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing event window: %v\n", err)
+		return
+	}
+	eventReasons, err := types.ParseReasons(*reasons)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing event reasons: %v\n", err)
+		return
+	}
+	client, err := collector.NewClientset(*masterURL, *kubeconfig)
+	if err != nil {
+		printFailure("Events", collector.NewFailure(err, 1, true))
+		return
+	}
+	c := collector.NewCollector(client)
+	// both stages share the scrape's budget
+	ctx, cancel := retryPolicy.WithBudget(context.Background())
+	defer cancel()
+	var events types.EventList
+	var covered types.Window
+	err = retryPolicy.Retry(ctx, func(ctx context.Context) error {
+		var err error
+		events, covered, err = fetchEvents(ctx, c, eventReasons, window)
+		return err
+	}, onFailure("Events", "Retrying fetchEvents..."))
+	if err == nil {
+		printEvents(events, covered)
 	}
 	fmt.Println("Getting ClusterInfo")
-	for i := 0; i < retryNumber; i++ {
-		info, err := fetchClusterInfo()
-		if err == nil {
-			fmt.Println(info.String())
-			break
+	var info *types.ClusterInfo
+	err = retryPolicy.Retry(ctx, func(ctx context.Context) error {
+		var err error
+		info, err = fetchClusterInfo(ctx, c)
+		return err
+	}, onFailure("ClusterInfo", "Retrying fetchClusterInfo..."))
+	if err == nil {
+		printClusterInfo(info)
+	}
+}
+
+// onFailure returns a function which prints each failed attempt to get what.
+func onFailure(what, retrying string) func(err error, attempt int, final bool) {
+	return func(err error, attempt int, final bool) {
+		printFailure(what, collector.NewFailure(err, attempt, final))
+		if !final && *outputFormat == "legacy" {
+			fmt.Print(retrying)
 		}
-		fmt.Printf("Error getting ClusterInfo: %v\n", err)
-		if i < retryNumber-1 {
-			fmt.Printf("Retrying fetchClusterInfo...")
+	}
+}
+
+// printFailure prints a failure record, or an error in the legacy format.
+func printFailure(what string, failure common.Failure) {
+	if *outputFormat != "legacy" {
+		record, err := failure.ToRecord()
+		if err == nil {
+			fmt.Println(record)
+			return
 		}
-		time.Sleep(1 * time.Minute)
 	}
+	fmt.Fprintf(os.Stderr, "Error getting %s: %v\n", what, failure.Error)
 }
 
-func fetchEvents() (types.DisruptiveEventList, error) {
-	eventsBlob, err := exec.Command("kubectl", "get", "ev", "--all-namespaces=true", "-o", "json").CombinedOutput()
+// printEvents prints the events, followed by the window they cover.  The
+// legacy format has no window.
+func printEvents(events types.EventList, covered types.Window) {
+	if *outputFormat == "legacy" {
+		fmt.Println(events.String())
+		return
+	}
+	records, err := events.ToRecords()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error getting Events: %v\n", err)
+		return
+	}
+	for _, record := range records {
+		fmt.Println(record)
+	}
+	record, err := covered.ToRecord()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error getting Events: %v\n", err)
+		return
+	}
+	fmt.Println(record)
+}
+
+func printClusterInfo(info *types.ClusterInfo) {
+	if *outputFormat == "legacy" {
+		fmt.Println(info.String())
+		return
+	}
+	record, err := info.ToRecord()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error getting ClusterInfo: %v\n", err)
+		return
+	}
+	fmt.Println(record)
+}
+
+// fetchEvents returns the events with one of the reasons in window, and the
+// period they cover.
+func fetchEvents(ctx context.Context, c *collector.Collector, reasons types.Reasons, window types.Window) (types.EventList, types.Window, error) {
+	events, err := c.ListEvents(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("Error getting events: %v\n", err)
+		return nil, types.Window{}, fmt.Errorf("Error getting events: %w", err)
 	}
-	var eventList v1.EventList
-	json.Unmarshal(eventsBlob, &eventList)
 
-	return types.GetDisruptiveEventList(eventList.Items), nil
+	// all events are used for the cover, as the oldest one shows how long
+	// the API server retains events for
+	return reasons.Filter(window.Filter(events)), window.Cover(events, time.Now()), nil
 }
 
-func fetchClusterInfo() (*types.ClusterInfo, error) {
-	nodesBlob, err := exec.Command("kubectl", "get", "no", "-o", "json").CombinedOutput()
+func fetchClusterInfo(ctx context.Context, c *collector.Collector) (*types.ClusterInfo, error) {
+	nodes, err := c.ListNodes(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("Error getting nodes: %v\n", err)
+		return nil, fmt.Errorf("Error getting nodes: %w", err)
 	}
-	var nodeList v1.NodeList
-	json.Unmarshal(nodesBlob, &nodeList)
 
-	podsBlob, err := exec.Command("kubectl", "get", "po", "--all-namespaces=true", "-o", "json").CombinedOutput()
+	pods, err := c.ListPods(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("Error getting pods: %v\n", err)
+		return nil, fmt.Errorf("Error getting pods: %w", err)
 	}
-	var podList v1.PodList
-	json.Unmarshal(podsBlob, &podList)
 
-	return types.GetClusterInfo(podList.Items, nodeList.Items), nil
+	return types.GetClusterInfo(pods, nodes), nil
+}
+
+// getEnv returns the value of the environment variable, or defaultValue if it
+// is not set.
+func getEnv(name, defaultValue string) string {
+	if value, ok := os.LookupEnv(name); ok {
+		return value
+	}
+	return defaultValue
 }
@@ -0,0 +1,124 @@
+package types
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+
+	"k8s.io/api/core/v1"
+)
+
+// Scopes of a breakdown of events.
+const (
+	NodeScope      = "node"
+	NamespaceScope = "namespace"
+	// WorkloadScope is the workload which owns the pod an event is about,
+	// as namespace/name.
+	WorkloadScope = "workload"
+)
+
+var (
+	// generated pod names end in a random suffix, e.g. -x7k2p
+	podSuffixRegexp = regexp.MustCompile(`-[bcdfghjklmnpqrstvwxz2456789]{5}$`)
+	// pods of a ReplicaSet also have its pod-template-hash, e.g. -5d8f7c9b6d
+	templateHashRegexp = regexp.MustCompile(`-[bcdfghjklmnpqrstvwxz2456789]{6,10}$`)
+	// pods of a StatefulSet end in their ordinal
+	ordinalRegexp = regexp.MustCompile(`-[0-9]+$`)
+)
+
+// ReasonCounts is the number of events of each reason.
+type ReasonCounts map[string]int32
+
+// Breakdown is the number of disruptive events of each reason per node,
+// namespace and owning workload.
+type Breakdown map[string]map[string]ReasonCounts
+
+// GetBreakdown returns the breakdown of the events.  Events without an
+// involved object or source, e.g. from legacy output, are left out.
+func GetBreakdown(events []v1.Event) Breakdown {
+	b := Breakdown{}
+	for _, event := range events {
+		count := eventCount(event)
+		if node := eventNode(event); node != "" {
+			b.add(NodeScope, node, event.Reason, count)
+		}
+		if event.InvolvedObject.Kind != "Pod" {
+			continue
+		}
+		namespace := event.InvolvedObject.Namespace
+		if namespace == "" {
+			namespace = event.Namespace
+		}
+		b.add(NamespaceScope, namespace, event.Reason, count)
+		b.add(WorkloadScope, namespace+"/"+workloadName(event.InvolvedObject.Name), event.Reason, count)
+	}
+	return b
+}
+
+func (b Breakdown) add(scope, name, reason string, count int32) {
+	if b[scope] == nil {
+		b[scope] = map[string]ReasonCounts{}
+	}
+	if b[scope][name] == nil {
+		b[scope][name] = ReasonCounts{}
+	}
+	b[scope][name][reason] += count
+}
+
+// ToRows returns one row of scope, name, reason, count and events per day for
+// each reason of each node, namespace and workload, sorted by scope, name and
+// reason.
+func (b Breakdown) ToRows(days float64) [][]string {
+	rows := [][]string{}
+	for _, scope := range []string{NodeScope, NamespaceScope, WorkloadScope} {
+		for _, name := range sortedKeys(b[scope]) {
+			counts := b[scope][name]
+			reasons := make([]string, 0, len(counts))
+			for reason := range counts {
+				reasons = append(reasons, reason)
+			}
+			sort.Strings(reasons)
+			for _, reason := range reasons {
+				rows = append(rows, []string{scope, name, reason, strconv.FormatInt(int64(counts[reason]), 10), perDay(counts[reason], days)})
+			}
+		}
+	}
+	return rows
+}
+
+// GetBreakdownHeader returns the header of the columns returned by ToRows.
+func GetBreakdownHeader() []string {
+	return []string{"Scope", "Name", "Reason", "Count", "Per Day"}
+}
+
+// eventNode returns the node an event occurred on: the host of the component
+// which reported it, or the node it is about.
+func eventNode(event v1.Event) string {
+	if event.Source.Host != "" {
+		return event.Source.Host
+	}
+	if event.InvolvedObject.Kind == "Node" {
+		return event.InvolvedObject.Name
+	}
+	return ""
+}
+
+// workloadName returns the name of the workload which owns the pod, derived
+// from the pod's name, as events do not include its owner.  e.g. web-5d8f7c9b6d-x7k2p
+// is owned by the Deployment web, and db-0 by the StatefulSet db.  The name
+// of a pod which was not generated is returned as is.
+func workloadName(pod string) string {
+	if trimmed := podSuffixRegexp.ReplaceAllString(pod, ""); trimmed != pod {
+		return templateHashRegexp.ReplaceAllString(trimmed, "")
+	}
+	return ordinalRegexp.ReplaceAllString(pod, "")
+}
+
+func sortedKeys(m map[string]ReasonCounts) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
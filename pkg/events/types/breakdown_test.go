@@ -0,0 +1,131 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestWorkloadName(t *testing.T) {
+	testCases := []struct {
+		name string
+		pod  string
+		want string
+	}{
+		{name: "ReplicaSet pod", pod: "web-5d8f7c9b6d-x7k2p", want: "web"},
+		{name: "ReplicaSet pod with a short hash", pod: "api-server-7c9b6d-x7k2p", want: "api-server"},
+		{name: "DaemonSet pod", pod: "fluentd-x7k2p", want: "fluentd"},
+		{name: "Job pod", pod: "job-abc-x7k2p", want: "job-abc"},
+		{name: "StatefulSet pod", pod: "db-0", want: "db"},
+		{name: "StatefulSet pod with a large ordinal", pod: "kafka-broker-12", want: "kafka-broker"},
+		{name: "bare pod", pod: "my-pod", want: "my-pod"},
+		{name: "bare pod without dashes", pod: "debug", want: "debug"},
+		{name: "suffix with vowels", pod: "cache-redis", want: "cache-redis"},
+		{name: "suffix with excluded digits", pod: "batch-13x7k", want: "batch-13x7k"},
+		{name: "suffix of six characters", pod: "web-bcdfgh", want: "web-bcdfgh"},
+		{name: "hash without a pod suffix", pod: "web-5d8f7c9b6d", want: "web-5d8f7c9b6d"},
+		{name: "workload name with vowels before the pod suffix", pod: "web-canary-x7k2p", want: "web-canary"},
+		{name: "workload name with excluded digits before the pod suffix", pod: "app-12345-x7k2p", want: "app-12345"},
+		{name: "StatefulSet whose name looks like a hash", pod: "kafka-bcdfg-0", want: "kafka-bcdfg"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := workloadName(tc.pod); got != tc.want {
+				t.Errorf("workloadName(%q) = %q, want %q", tc.pod, got, tc.want)
+			}
+		})
+	}
+}
+
+// podEvent returns an event about a pod, reported by the kubelet on node.
+func podEvent(reason, namespace, pod, node string, count int32) v1.Event {
+	return v1.Event{
+		Reason:         reason,
+		Count:          count,
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Namespace: namespace, Name: pod},
+		Source:         v1.EventSource{Host: node},
+	}
+}
+
+func TestGetBreakdown(t *testing.T) {
+	testCases := []struct {
+		name   string
+		events []v1.Event
+		want   Breakdown
+	}{
+		{
+			name: "pods of a workload on several nodes",
+			events: []v1.Event{
+				podEvent("Evicted", "ns", "web-5d8f7c9b6d-x7k2p", "n1", 2),
+				podEvent("Evicted", "ns", "web-5d8f7c9b6d-x9k2q", "n2", 1),
+				podEvent("OOMKilling", "ns", "db-0", "n1", 1),
+			},
+			want: Breakdown{
+				NodeScope:      {"n1": {"Evicted": 2, "OOMKilling": 1}, "n2": {"Evicted": 1}},
+				NamespaceScope: {"ns": {"Evicted": 3, "OOMKilling": 1}},
+				WorkloadScope:  {"ns/web": {"Evicted": 3}, "ns/db": {"OOMKilling": 1}},
+			},
+		},
+		{
+			name: "same workload name in different namespaces",
+			events: []v1.Event{
+				podEvent("Evicted", "a", "web-x7k2p", "n1", 1),
+				podEvent("Evicted", "b", "web-x9k2q", "n1", 1),
+			},
+			want: Breakdown{
+				NodeScope:      {"n1": {"Evicted": 2}},
+				NamespaceScope: {"a": {"Evicted": 1}, "b": {"Evicted": 1}},
+				WorkloadScope:  {"a/web": {"Evicted": 1}, "b/web": {"Evicted": 1}},
+			},
+		},
+		{
+			name: "node event",
+			events: []v1.Event{
+				{Reason: "SystemOOM", InvolvedObject: v1.ObjectReference{Kind: "Node", Name: "n1"}},
+			},
+			want: Breakdown{NodeScope: {"n1": {"SystemOOM": 1}}},
+		},
+		{
+			name: "namespace of the event",
+			events: []v1.Event{
+				{Reason: "Evicted", ObjectMeta: metav1.ObjectMeta{Namespace: "ns"}, InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "my-pod"}},
+			},
+			want: Breakdown{
+				NamespaceScope: {"ns": {"Evicted": 1}},
+				WorkloadScope:  {"ns/my-pod": {"Evicted": 1}},
+			},
+		},
+		{
+			name:   "legacy event",
+			events: []v1.Event{{Reason: "Evicted", Count: 3}},
+			want:   Breakdown{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := GetBreakdown(tc.events); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("GetBreakdown() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBreakdownToRows(t *testing.T) {
+	b := GetBreakdown([]v1.Event{
+		podEvent("OOMKilling", "ns", "web-x7k2p", "n1", 1),
+		podEvent("Evicted", "ns", "web-x7k2p", "n1", 4),
+	})
+	want := [][]string{
+		{NodeScope, "n1", "Evicted", "4", "2.00"},
+		{NodeScope, "n1", "OOMKilling", "1", "0.50"},
+		{NamespaceScope, "ns", "Evicted", "4", "2.00"},
+		{NamespaceScope, "ns", "OOMKilling", "1", "0.50"},
+		{WorkloadScope, "ns/web", "Evicted", "4", "2.00"},
+		{WorkloadScope, "ns/web", "OOMKilling", "1", "0.50"},
+	}
+	if got := b.ToRows(2); !reflect.DeepEqual(got, want) {
+		t.Errorf("ToRows() = %v, want %v", got, want)
+	}
+}
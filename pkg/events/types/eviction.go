@@ -0,0 +1,185 @@
+package types
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Resources starved by the evictions, as named in the kubelet's eviction
+// messages.  The kubelet reports both the node and image filesystems as
+// ephemeral-storage, or inodes if they ran out of inodes.
+const (
+	MemoryResource           = "memory"
+	EphemeralStorageResource = "ephemeral-storage"
+	InodesResource           = "inodes"
+	PIDsResource             = "pids"
+	// UnknownResource is used for messages which could not be parsed.
+	UnknownResource = "unknown"
+)
+
+const (
+	evictedReason = "Evicted"
+	quantityExpr  = `([-+]?[0-9.]+[a-zA-Z]*)`
+)
+
+var (
+	lowOnResourceRegexp = regexp.MustCompile(`low on resource: ([\w.-]+)\.`)
+	thresholdRegexp     = regexp.MustCompile(`Threshold quantity: ` + quantityExpr + `, available: ` + quantityExpr + `\.`)
+	// e.g. Container app was using 1Gi, request is 512Mi, has larger consumption of memory.
+	containerRegexp = regexp.MustCompile(`Container (\S+) was using ` + quantityExpr + `, request is ` + quantityExpr + `,`)
+	// e.g. Container app was using 1Gi, which exceeds its request of 512Mi.
+	legacyContainerRegexp = regexp.MustCompile(`Container (\S+) was using ` + quantityExpr + `, which exceeds its request of ` + quantityExpr + `\.`)
+	// e.g. Container app exceeded its local ephemeral storage limit "1Gi".
+	containerLimitRegexp = regexp.MustCompile(`Container (\S+) exceeded its local ephemeral storage limit "` + quantityExpr + `"`)
+	// pods and emptyDir volumes which exceed their ephemeral storage limits
+	storageLimitRegexp = regexp.MustCompile(`Pod ephemeral local storage usage exceeds|Usage of EmptyDir volume`)
+)
+
+// ContainerUsage is a container named in an eviction message, along with its
+// usage and request, or its limit if it exceeded its ephemeral storage limit.
+type ContainerUsage struct {
+	Name    string            `json:"name"`
+	Usage   resource.Quantity `json:"usage"`
+	Request resource.Quantity `json:"request"`
+	Limit   resource.Quantity `json:"limit"`
+}
+
+// Eviction is the detail parsed from the message of an eviction event.
+type Eviction struct {
+	// Resource is the resource the node or pod was starved of.
+	Resource string `json:"resource"`
+	// Threshold and Available are the node's eviction threshold, and what was
+	// available when it was crossed.
+	Threshold  resource.Quantity `json:"threshold"`
+	Available  resource.Quantity `json:"available"`
+	Containers []ContainerUsage  `json:"containers"`
+}
+
+// ParseEviction parses the message of an eviction event, e.g. "The node was
+// low on resource: memory. Threshold quantity: 100Mi, available: 91572Ki.
+// Container app was using 1Gi, request is 512Mi, has larger consumption of
+// memory."  Quantities which can not be parsed are left zero.
+func ParseEviction(message string) Eviction {
+	eviction := Eviction{Resource: UnknownResource, Containers: []ContainerUsage{}}
+	if submatches := lowOnResourceRegexp.FindStringSubmatch(message); submatches != nil {
+		eviction.Resource = submatches[1]
+	} else if storageLimitRegexp.MatchString(message) {
+		eviction.Resource = EphemeralStorageResource
+	}
+	if submatches := thresholdRegexp.FindStringSubmatch(message); submatches != nil {
+		eviction.Threshold = parseQuantity(submatches[1])
+		eviction.Available = parseQuantity(submatches[2])
+	}
+	for _, r := range []*regexp.Regexp{containerRegexp, legacyContainerRegexp} {
+		for _, submatches := range r.FindAllStringSubmatch(message, -1) {
+			eviction.Containers = append(eviction.Containers, ContainerUsage{
+				Name:    submatches[1],
+				Usage:   parseQuantity(submatches[2]),
+				Request: parseQuantity(submatches[3]),
+			})
+		}
+	}
+	for _, submatches := range containerLimitRegexp.FindAllStringSubmatch(message, -1) {
+		eviction.Resource = EphemeralStorageResource
+		eviction.Containers = append(eviction.Containers, ContainerUsage{
+			Name:  submatches[1],
+			Limit: parseQuantity(submatches[2]),
+		})
+	}
+	return eviction
+}
+
+func parseQuantity(value string) resource.Quantity {
+	q, err := resource.ParseQuantity(strings.TrimSuffix(value, "."))
+	if err != nil {
+		return resource.Quantity{}
+	}
+	return q
+}
+
+// EvictionStat summarizes the evictions caused by a starved resource.  An
+// event which was repeated counts as that many evictions, each of the
+// containers in its message.
+type EvictionStat struct {
+	Evictions int32 `json:"evictions"`
+	// Containers is the number of containers named in the messages, which
+	// used more than they requested.
+	Containers int `json:"containers"`
+	// Usage and Requests are the totals of those containers, in the
+	// resource's base unit.
+	Usage    int64 `json:"usage"`
+	Requests int64 `json:"requests"`
+	// ContainersOverLimit is the number of containers named in the
+	// messages, which exceeded their ephemeral storage limit, and Limits is
+	// the total of their limits.
+	ContainersOverLimit int   `json:"containersOverLimit"`
+	Limits              int64 `json:"limits"`
+}
+
+// EvictionStats are the eviction stats of a cluster per starved resource.
+type EvictionStats map[string]*EvictionStat
+
+// GetEvictionStats parses the messages of the eviction events, and sums them
+// per starved resource.
+func GetEvictionStats(events []v1.Event) EvictionStats {
+	stats := EvictionStats{}
+	for _, event := range events {
+		if event.Reason != evictedReason {
+			continue
+		}
+		eviction := ParseEviction(event.Message)
+		stat, ok := stats[eviction.Resource]
+		if !ok {
+			stat = &EvictionStat{}
+			stats[eviction.Resource] = stat
+		}
+		count := eventCount(event)
+		stat.Evictions += count
+		for _, container := range eviction.Containers {
+			if !container.Limit.IsZero() {
+				stat.ContainersOverLimit += int(count)
+				stat.Limits += int64(count) * container.Limit.Value()
+				continue
+			}
+			stat.Containers += int(count)
+			stat.Usage += int64(count) * container.Usage.Value()
+			stat.Requests += int64(count) * container.Request.Value()
+		}
+	}
+	return stats
+}
+
+// ToRows returns one row of resource, evictions, containers over their
+// request, with their usage and requests, and containers over their limit,
+// with their limits, per starved resource, sorted by resource.
+func (e EvictionStats) ToRows() [][]string {
+	resources := make([]string, 0, len(e))
+	for r := range e {
+		resources = append(resources, r)
+	}
+	sort.Strings(resources)
+	rows := [][]string{}
+	for _, r := range resources {
+		stat := e[r]
+		rows = append(rows, []string{
+			r,
+			strconv.FormatInt(int64(stat.Evictions), 10),
+			strconv.Itoa(stat.Containers),
+			strconv.FormatInt(stat.Usage, 10),
+			strconv.FormatInt(stat.Requests, 10),
+			strconv.Itoa(stat.ContainersOverLimit),
+			strconv.FormatInt(stat.Limits, 10),
+		})
+	}
+	return rows
+}
+
+// GetEvictionHeader returns the header of the columns returned by ToRows.
+func GetEvictionHeader() []string {
+	return []string{"Resource", "Evictions", "Containers Over Request", "Usage", "Requests", "Containers Over Limit", "Limits"}
+}
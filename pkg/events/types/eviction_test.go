@@ -0,0 +1,127 @@
+package types
+
+import (
+	"testing"
+
+	"k8s.io/api/core/v1"
+)
+
+func TestParseEviction(t *testing.T) {
+	testCases := []struct {
+		name           string
+		message        string
+		wantResource   string
+		wantThreshold  int64
+		wantAvailable  int64
+		wantContainers []ContainerUsage
+	}{
+		{
+			name:          "memory",
+			message:       "The node was low on resource: memory. Threshold quantity: 100Mi, available: 91572Ki. Container app was using 1048576Ki, request is 512Mi, has larger consumption of memory. Container sidecar was using 10Mi, request is 0, has larger consumption of memory. ",
+			wantResource:  MemoryResource,
+			wantThreshold: 100 << 20,
+			wantAvailable: 91572 << 10,
+			wantContainers: []ContainerUsage{
+				{Name: "app", Usage: parseQuantity("1Gi"), Request: parseQuantity("512Mi")},
+				{Name: "sidecar", Usage: parseQuantity("10Mi")},
+			},
+		},
+		{
+			name:           "ephemeral storage",
+			message:        "The node was low on resource: ephemeral-storage. Threshold quantity: 10Gi, available: 9Gi. Container worker was using 20Gi, request is 0, has larger consumption of ephemeral-storage. ",
+			wantResource:   EphemeralStorageResource,
+			wantThreshold:  10 << 30,
+			wantAvailable:  9 << 30,
+			wantContainers: []ContainerUsage{{Name: "worker", Usage: parseQuantity("20Gi")}},
+		},
+		{
+			name:           "inodes",
+			message:        "The node was low on resource: inodes. Threshold quantity: 5%, available: 1000. ",
+			wantResource:   InodesResource,
+			wantContainers: []ContainerUsage{},
+		},
+		{
+			name:           "pids",
+			message:        "The node was low on resource: pids. Threshold quantity: 100, available: 50. ",
+			wantResource:   PIDsResource,
+			wantThreshold:  100,
+			wantAvailable:  50,
+			wantContainers: []ContainerUsage{},
+		},
+		{
+			name:           "legacy container usage",
+			message:        "The node was low on resource: memory. Container app was using 1.5Gi, which exceeds its request of 1Gi.",
+			wantResource:   MemoryResource,
+			wantContainers: []ContainerUsage{{Name: "app", Usage: parseQuantity("1536Mi"), Request: parseQuantity("1Gi")}},
+		},
+		{
+			name:           "container ephemeral storage limit",
+			message:        `Container writer exceeded its local ephemeral storage limit "1Gi". `,
+			wantResource:   EphemeralStorageResource,
+			wantContainers: []ContainerUsage{{Name: "writer", Limit: parseQuantity("1Gi")}},
+		},
+		{
+			name:           "pod ephemeral storage limit",
+			message:        "Pod ephemeral local storage usage exceeds the total limit of containers 1Gi. ",
+			wantResource:   EphemeralStorageResource,
+			wantContainers: []ContainerUsage{},
+		},
+		{
+			name:           "emptyDir size limit",
+			message:        "Usage of EmptyDir volume \"cache\" exceeds the limit \"500Mi\". ",
+			wantResource:   EphemeralStorageResource,
+			wantContainers: []ContainerUsage{},
+		},
+		{
+			name:           "unknown",
+			message:        "Pod was evicted by the taint manager",
+			wantResource:   UnknownResource,
+			wantContainers: []ContainerUsage{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := ParseEviction(tc.message)
+			if got.Resource != tc.wantResource {
+				t.Errorf("got resource %q, want %q", got.Resource, tc.wantResource)
+			}
+			if got.Threshold.Value() != tc.wantThreshold || got.Available.Value() != tc.wantAvailable {
+				t.Errorf("got threshold %v and available %v, want %d and %d", got.Threshold.String(), got.Available.String(), tc.wantThreshold, tc.wantAvailable)
+			}
+			if len(got.Containers) != len(tc.wantContainers) {
+				t.Fatalf("got containers %+v, want %+v", got.Containers, tc.wantContainers)
+			}
+			for i, want := range tc.wantContainers {
+				c := got.Containers[i]
+				if c.Name != want.Name || c.Usage.Cmp(want.Usage) != 0 || c.Request.Cmp(want.Request) != 0 || c.Limit.Cmp(want.Limit) != 0 {
+					t.Errorf("got container %+v, want %+v", c, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGetEvictionStats(t *testing.T) {
+	memory := "The node was low on resource: memory. Container app was using 2Gi, request is 1Gi, has larger consumption of memory. "
+	stats := GetEvictionStats([]v1.Event{
+		{Reason: "Evicted", Count: 3, Message: memory},
+		{Reason: "Evicted", Message: memory},
+		{Reason: "Evicted", Count: 2, Message: "The node was low on resource: inodes. "},
+		{Reason: "Evicted", Count: 2, Message: `Container worker exceeded its local ephemeral storage limit "1Gi". `},
+		{Reason: "Evicted", Message: "The node was low on resource: ephemeral-storage. Container worker was using 20Gi, request is 0, has larger consumption of ephemeral-storage. "},
+		{Reason: "OOMKilling", Count: 5, Message: memory},
+	})
+	want := EvictionStats{
+		MemoryResource:           {Evictions: 4, Containers: 4, Usage: 4 * 2 << 30, Requests: 4 * 1 << 30},
+		InodesResource:           {Evictions: 2},
+		EphemeralStorageResource: {Evictions: 3, Containers: 1, Usage: 20 << 30, ContainersOverLimit: 2, Limits: 2 * 1 << 30},
+	}
+	if len(stats) != len(want) {
+		t.Fatalf("got stats for %d resources, want %d", len(stats), len(want))
+	}
+	for resource, stat := range want {
+		if got, ok := stats[resource]; !ok || *got != *stat {
+			t.Errorf("got %s stats %+v, want %+v", resource, got, stat)
+		}
+	}
+}
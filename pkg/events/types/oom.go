@@ -0,0 +1,202 @@
+package types
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/api/core/v1"
+)
+
+// Kinds of OOM kills.
+const (
+	// ContainerOOMKind is an OOM kill of a process in a container.
+	ContainerOOMKind = "container"
+	// SystemOOMKind is an OOM kill of the kubelet, the container runtime or
+	// another system daemon, which shows that too little was reserved for
+	// them.
+	SystemOOMKind = "system"
+)
+
+const (
+	oomKillingReason = "OOMKilling"
+	systemOOMReason  = "SystemOOM"
+	unknownProcess   = "unknown"
+	// systemOOMScoreAdj is the oom_score_adj at or below which processes are
+	// system daemons, e.g. -999 for the kubelet and container runtime.
+	// Guaranteed pods get -997.
+	systemOOMScoreAdj = -998
+)
+
+var (
+	// e.g. Killed process 4321 (java) or Kill process 4321 (java) score 1035
+	killedProcessRegexp = regexp.MustCompile(`Kill(?:ed)? process (\d+) \(([^)]+)\)`)
+	// e.g. System OOM encountered, victim process: containerd, pid: 1234
+	victimProcessRegexp = regexp.MustCompile(`victim process: ([^,]+), pid: (\d+)`)
+	// e.g. task_memcg=/kubepods/burstable/pod<uid>/<id>,task=java,pid=4321
+	taskMemcgRegexp   = regexp.MustCompile(`task_memcg=([^,\s]+)`)
+	taskRegexp        = regexp.MustCompile(`task=([^,\s]+),pid=(\d+)`)
+	oomScoreAdjRegexp = regexp.MustCompile(`oom_score_adj:(-?\d+)`)
+	// the pod's UID, with underscores in place of dashes for the systemd
+	// cgroup driver
+	podUIDRegexp = regexp.MustCompile(`pod([0-9a-f]{8}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{12})`)
+)
+
+// systemProcesses are the names of the system daemons on a node, used when a
+// message does not include the killed process's cgroup.
+var systemProcesses = []string{
+	"kubelet",
+	"containerd",
+	"dockerd",
+	"docker",
+	"crio",
+	"conmon",
+	"runc",
+	"systemd",
+	"sshd",
+}
+
+// OOM is the detail parsed from the message of an OOMKilling or SystemOOM
+// event.
+type OOM struct {
+	Kind    string `json:"kind"`
+	Process string `json:"process"`
+	PID     int    `json:"pid,omitempty"`
+	// Cgroup is the memory cgroup of the killed process, if in the message.
+	Cgroup string `json:"cgroup,omitempty"`
+	// PodUID and ContainerID are parsed from the cgroup of a process in a
+	// container.
+	PodUID      string `json:"podUID,omitempty"`
+	ContainerID string `json:"containerID,omitempty"`
+}
+
+// ParseOOM parses the message of an OOMKilling event from node problem
+// detector, which holds the kernel's log of the kill, or of a SystemOOM event
+// from the kubelet.  The kill is of a container unless the process is in a
+// cgroup outside of kubepods, has the oom_score_adj of a system daemon, or is
+// a known system daemon.
+func ParseOOM(message string) OOM {
+	oom := OOM{Kind: ContainerOOMKind, Process: unknownProcess}
+	if submatches := killedProcessRegexp.FindStringSubmatch(message); submatches != nil {
+		oom.PID, _ = strconv.Atoi(submatches[1])
+		oom.Process = submatches[2]
+	} else if submatches := victimProcessRegexp.FindStringSubmatch(message); submatches != nil {
+		oom.Process = strings.TrimSpace(submatches[1])
+		oom.PID, _ = strconv.Atoi(submatches[2])
+	} else if submatches := taskRegexp.FindStringSubmatch(message); submatches != nil {
+		oom.Process = submatches[1]
+		oom.PID, _ = strconv.Atoi(submatches[2])
+	}
+	if submatches := taskMemcgRegexp.FindStringSubmatch(message); submatches != nil {
+		oom.Cgroup = submatches[1]
+		if !strings.Contains(oom.Cgroup, "kubepods") {
+			oom.Kind = SystemOOMKind
+			return oom
+		}
+		if submatches := podUIDRegexp.FindStringSubmatch(oom.Cgroup); submatches != nil {
+			oom.PodUID = strings.ReplaceAll(submatches[1], "_", "-")
+		}
+		oom.ContainerID = containerID(oom.Cgroup)
+		return oom
+	}
+	if submatches := oomScoreAdjRegexp.FindStringSubmatch(message); submatches != nil {
+		if adj, err := strconv.Atoi(submatches[1]); err == nil && adj <= systemOOMScoreAdj {
+			oom.Kind = SystemOOMKind
+			return oom
+		}
+	}
+	if isSystemProcess(oom.Process) {
+		oom.Kind = SystemOOMKind
+	}
+	return oom
+}
+
+// containerID returns the ID of the container from the last element of its
+// cgroup, e.g. cri-containerd-<id>.scope, or an empty string if the cgroup is
+// the pod's.
+func containerID(cgroup string) string {
+	id := cgroup[strings.LastIndex(cgroup, "/")+1:]
+	if podUIDRegexp.MatchString(id) {
+		return ""
+	}
+	id = strings.TrimSuffix(id, ".scope")
+	if i := strings.LastIndex(id, "-"); i >= 0 {
+		id = id[i+1:]
+	}
+	return id
+}
+
+func isSystemProcess(process string) bool {
+	for _, system := range systemProcesses {
+		if strings.HasPrefix(process, system) {
+			return true
+		}
+	}
+	return false
+}
+
+// OOMStats are the number of OOM kills of a cluster per kind and killed
+// process.
+type OOMStats map[string]map[string]int32
+
+// GetOOMStats parses the messages of the OOMKilling and SystemOOM events, and
+// counts them per kind and process.  As both node problem detector and the
+// kubelet can report the same kill, events on the same node with the same pid
+// and process are only counted once.
+func GetOOMStats(events []v1.Event) OOMStats {
+	stats := OOMStats{ContainerOOMKind: {}, SystemOOMKind: {}}
+	type kill struct {
+		node    string
+		pid     int
+		process string
+	}
+	counted := map[kill]int32{}
+	for _, event := range events {
+		if event.Reason != oomKillingReason && event.Reason != systemOOMReason {
+			continue
+		}
+		oom := ParseOOM(event.Message)
+		count := eventCount(event)
+		if oom.PID != 0 {
+			k := kill{node: eventNode(event), pid: oom.PID, process: oom.Process}
+			if count <= counted[k] {
+				continue
+			}
+			count, counted[k] = count-counted[k], count
+		}
+		stats[oom.Kind][oom.Process] += count
+	}
+	return stats
+}
+
+// Total returns the number of OOM kills of the given kind.
+func (o OOMStats) Total(kind string) int32 {
+	total := int32(0)
+	for _, count := range o[kind] {
+		total += count
+	}
+	return total
+}
+
+// ToRows returns one row of kind, process and count per killed process,
+// sorted by kind and process.
+func (o OOMStats) ToRows() [][]string {
+	rows := [][]string{}
+	for _, kind := range []string{ContainerOOMKind, SystemOOMKind} {
+		processes := make([]string, 0, len(o[kind]))
+		for process := range o[kind] {
+			processes = append(processes, process)
+		}
+		sort.Strings(processes)
+		for _, process := range processes {
+			rows = append(rows, []string{kind, process, strconv.FormatInt(int64(o[kind][process]), 10)})
+		}
+	}
+	return rows
+}
+
+// GetOOMHeader returns the header of the columns returned by ToRows.
+func GetOOMHeader() []string {
+	return []string{"Kind", "Process", "Count"}
+}
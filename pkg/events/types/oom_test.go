@@ -0,0 +1,120 @@
+package types
+
+import (
+	"testing"
+
+	"k8s.io/api/core/v1"
+)
+
+func TestParseOOM(t *testing.T) {
+	testCases := []struct {
+		name    string
+		message string
+		want    OOM
+	}{
+		{
+			name:    "NPD container kill",
+			message: "Memory cgroup out of memory: Killed process 4321 (java) total-vm:5000kB, anon-rss:4000kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:100kB oom_score_adj:985",
+			want:    OOM{Kind: ContainerOOMKind, Process: "java", PID: 4321},
+		},
+		{
+			name:    "NPD kill of a system daemon by oom_score_adj",
+			message: "Out of memory: Killed process 2000 (node-exporter) total-vm:5000kB, anon-rss:4000kB oom_score_adj:-999",
+			want:    OOM{Kind: SystemOOMKind, Process: "node-exporter", PID: 2000},
+		},
+		{
+			name:    "NPD kill of a guaranteed pod",
+			message: "Memory cgroup out of memory: Killed process 3000 (postgres) total-vm:5000kB oom_score_adj:-997",
+			want:    OOM{Kind: ContainerOOMKind, Process: "postgres", PID: 3000},
+		},
+		{
+			name:    "NPD kill of a known daemon",
+			message: "Out of memory: Kill process 777 (kubelet) score 1035 or sacrifice child",
+			want:    OOM{Kind: SystemOOMKind, Process: "kubelet", PID: 777},
+		},
+		{
+			name:    "NPD kill with a cgroupfs memcg",
+			message: "oom-kill:constraint=CONSTRAINT_MEMCG,nodemask=(null),cpuset=abc,mems_allowed=0,oom_memcg=/kubepods/burstable/pod0b4f1a52-7f5e-4c1e-9d3a-1c2b3d4e5f60,task_memcg=/kubepods/burstable/pod0b4f1a52-7f5e-4c1e-9d3a-1c2b3d4e5f60/8f2a1b,task=java,pid=4321,uid=0",
+			want: OOM{
+				Kind:        ContainerOOMKind,
+				Process:     "java",
+				PID:         4321,
+				Cgroup:      "/kubepods/burstable/pod0b4f1a52-7f5e-4c1e-9d3a-1c2b3d4e5f60/8f2a1b",
+				PodUID:      "0b4f1a52-7f5e-4c1e-9d3a-1c2b3d4e5f60",
+				ContainerID: "8f2a1b",
+			},
+		},
+		{
+			name:    "NPD kill with a systemd memcg",
+			message: "oom-kill:constraint=CONSTRAINT_NONE,task_memcg=/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod0b4f1a52_7f5e_4c1e_9d3a_1c2b3d4e5f60.slice/cri-containerd-abc123.scope,task=app,pid=5",
+			want: OOM{
+				Kind:        ContainerOOMKind,
+				Process:     "app",
+				PID:         5,
+				Cgroup:      "/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod0b4f1a52_7f5e_4c1e_9d3a_1c2b3d4e5f60.slice/cri-containerd-abc123.scope",
+				PodUID:      "0b4f1a52-7f5e-4c1e-9d3a-1c2b3d4e5f60",
+				ContainerID: "abc123",
+			},
+		},
+		{
+			name:    "NPD kill in the pod cgroup",
+			message: "oom-kill:constraint=CONSTRAINT_MEMCG,task_memcg=/kubepods/pod0b4f1a52-7f5e-4c1e-9d3a-1c2b3d4e5f60,task=pause,pid=9",
+			want: OOM{
+				Kind:    ContainerOOMKind,
+				Process: "pause",
+				PID:     9,
+				Cgroup:  "/kubepods/pod0b4f1a52-7f5e-4c1e-9d3a-1c2b3d4e5f60",
+				PodUID:  "0b4f1a52-7f5e-4c1e-9d3a-1c2b3d4e5f60",
+			},
+		},
+		{
+			name:    "NPD kill outside of kubepods",
+			message: "oom-kill:constraint=CONSTRAINT_NONE,task_memcg=/system.slice/fluentd.service,task=ruby,pid=6",
+			want:    OOM{Kind: SystemOOMKind, Process: "ruby", PID: 6, Cgroup: "/system.slice/fluentd.service"},
+		},
+		{
+			name:    "kubelet system daemon",
+			message: "System OOM encountered, victim process: containerd, pid: 1234",
+			want:    OOM{Kind: SystemOOMKind, Process: "containerd", PID: 1234},
+		},
+		{
+			name:    "kubelet container process",
+			message: "System OOM encountered, victim process: python, pid: 999",
+			want:    OOM{Kind: ContainerOOMKind, Process: "python", PID: 999},
+		},
+		{
+			name:    "kubelet without a victim",
+			message: "System OOM encountered",
+			want:    OOM{Kind: ContainerOOMKind, Process: unknownProcess},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ParseOOM(tc.message); got != tc.want {
+				t.Errorf("ParseOOM() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGetOOMStats(t *testing.T) {
+	stats := GetOOMStats([]v1.Event{
+		// reported by both node problem detector and the kubelet
+		{Reason: oomKillingReason, Message: "Out of memory: Killed process 777 (kubelet) oom_score_adj:-999", Source: v1.EventSource{Host: "a"}},
+		{Reason: systemOOMReason, Message: "System OOM encountered, victim process: kubelet, pid: 777", Source: v1.EventSource{Host: "a"}},
+		// the same pid on another node
+		{Reason: systemOOMReason, Message: "System OOM encountered, victim process: kubelet, pid: 777", Source: v1.EventSource{Host: "b"}},
+		{Reason: oomKillingReason, Count: 3, Message: "Memory cgroup out of memory: Killed process 1 (java)", Source: v1.EventSource{Host: "a"}},
+		{Reason: oomKillingReason, Message: "Memory cgroup out of memory: Killed process 2 (java)", Source: v1.EventSource{Host: "a"}},
+		{Reason: "Evicted", Message: "Killed process 3 (java)"},
+	})
+	if got := stats.Total(SystemOOMKind); got != 2 {
+		t.Errorf("got %d system OOMs, want 2", got)
+	}
+	if got := stats.Total(ContainerOOMKind); got != 4 {
+		t.Errorf("got %d container OOMs, want 4", got)
+	}
+	if got := stats[ContainerOOMKind]["java"]; got != 4 {
+		t.Errorf("got %d OOMs of java, want 4", got)
+	}
+}
@@ -0,0 +1,75 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/api/core/v1"
+)
+
+// DefaultProfile is the profile of events scraped and processed by default.
+const DefaultProfile = "disruptive"
+
+// Profiles are the built-in sets of event reasons.
+var Profiles = map[string]Reasons{
+	DefaultProfile: {"Evicted", "OOMKilling", "SystemOOM"},
+	"scheduling":   {"FailedScheduling", "Preempted"},
+	"node-health":  {"NodeNotReady", "NodeHasDiskPressure", "NodeHasInsufficientMemory", "Rebooted"},
+	"crashes":      {"BackOff", "Killing"},
+}
+
+// Reasons are the reasons of the events to scrape and process, in the order
+// of their columns in the output.
+type Reasons []string
+
+// ParseReasons parses a comma separated list of profiles and event reasons,
+// e.g. disruptive,scheduling,FailedMount.  Each profile is replaced by its
+// reasons.
+func ParseReasons(value string) (Reasons, error) {
+	reasons := Reasons{}
+	seen := map[string]bool{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		expanded, ok := Profiles[name]
+		if !ok {
+			expanded = Reasons{name}
+		}
+		for _, reason := range expanded {
+			if !seen[reason] {
+				seen[reason] = true
+				reasons = append(reasons, reason)
+			}
+		}
+	}
+	if len(reasons) == 0 {
+		return nil, fmt.Errorf("No event reasons in %q, expected a comma separated list of reasons, or of the profiles %s", value, strings.Join(profileNames(), ", "))
+	}
+	return reasons, nil
+}
+
+// Filter returns the events with one of the reasons.
+func (r Reasons) Filter(events []v1.Event) []v1.Event {
+	filtered := []v1.Event{}
+	for _, event := range events {
+		for _, reason := range r {
+			if event.Reason == reason {
+				filtered = append(filtered, event)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+func profileNames() []string {
+	names := make([]string, 0, len(Profiles))
+	for name := range Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,59 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/api/core/v1"
+)
+
+func TestParseReasons(t *testing.T) {
+	testCases := []struct {
+		name    string
+		value   string
+		want    Reasons
+		wantErr bool
+	}{
+		{name: "default profile", value: DefaultProfile, want: Reasons{"Evicted", "OOMKilling", "SystemOOM"}},
+		{name: "single reason", value: "FailedMount", want: Reasons{"FailedMount"}},
+		{
+			name:  "profiles and reasons",
+			value: "scheduling,FailedMount,crashes",
+			want:  Reasons{"FailedScheduling", "Preempted", "FailedMount", "BackOff", "Killing"},
+		},
+		{
+			name:  "duplicates are removed",
+			value: "Evicted,disruptive,OOMKilling,Evicted",
+			want:  Reasons{"Evicted", "OOMKilling", "SystemOOM"},
+		},
+		{name: "whitespace and empty entries", value: " Evicted , ,Killing,", want: Reasons{"Evicted", "Killing"}},
+		{name: "empty", value: "", wantErr: true},
+		{name: "only separators", value: " , ,", wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseReasons(tc.value)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("ParseReasons(%q) = %q, want an error", tc.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseReasons(%q) returned error: %v", tc.value, err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ParseReasons(%q) = %q, want %q", tc.value, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFilterReasons(t *testing.T) {
+	events := []v1.Event{{Reason: "Evicted"}, {Reason: "Pulled"}, {Reason: "SystemOOM"}, {Reason: "Evicted"}}
+	got := Reasons{"SystemOOM", "Evicted"}.Filter(events)
+	want := []v1.Event{{Reason: "Evicted"}, {Reason: "SystemOOM"}, {Reason: "Evicted"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Filter() = %+v, want %+v", got, want)
+	}
+}
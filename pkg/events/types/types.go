@@ -1,12 +1,17 @@
 package types
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
 	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/dashpole/allocatable/pkg/common"
 )
 
 const (
@@ -16,19 +21,45 @@ const (
 	eventTemplate       = "Reason: %v, Message: %v, Count: %v"
 )
 
+var (
+	clusterInfoRegexp = regexp.MustCompile(clusterInfoExpr)
+	eventRegexp       = regexp.MustCompile(eventExpr)
+)
+
+// ErrMissingClusterInfo is returned when the events output of a cluster has no
+// cluster info, usually because the scraper was unable to get it.
+var ErrMissingClusterInfo = errors.New("Unable to find ClusterInfo")
+
 type ClusterInfo struct {
-	pods        int
-	nodes       int
-	cores       int
-	nodeVersion string
+	Pods        int    `json:"pods"`
+	Nodes       int    `json:"nodes"`
+	Cores       int    `json:"cores"`
+	NodeVersion string `json:"nodeVersion"`
 }
 
-type DisruptiveEventList []v1.Event
+// EventList is a list of events, which can be printed as scraper output.
+type EventList []v1.Event
+
+// ClusterEvents are the cluster info and events of a cluster.
+type ClusterEvents struct {
+	Info *ClusterInfo
+	// Reasons are the reasons of the events which were kept.
+	Reasons Reasons
+	// Events are aggregated by reason.
+	Events EventList
+	// Breakdown is the number of events per node, namespace and workload.
+	Breakdown Breakdown
+	// Evictions are the details of the evictions per starved resource.
+	Evictions EvictionStats
+	// OOMs are the number of OOM kills per kind and process.
+	OOMs OOMStats
+	// Window is the period the events cover.  It is unbounded if unknown,
+	// e.g. for legacy output, which has no timestamps.
+	Window Window
+}
 
 func ParseClusterInfo(input string) (*ClusterInfo, error) {
-	re := regexp.MustCompile(clusterInfoExpr)
-	if re.MatchString(input) {
-		submatches := re.FindStringSubmatch(input)
+	if submatches := clusterInfoRegexp.FindStringSubmatch(input); submatches != nil {
 		pods, err := strconv.Atoi(submatches[1])
 		if err != nil {
 			return nil, err
@@ -42,10 +73,10 @@ func ParseClusterInfo(input string) (*ClusterInfo, error) {
 			return nil, err
 		}
 		return &ClusterInfo{
-			pods:        pods,
-			nodes:       nodes,
-			cores:       cores,
-			nodeVersion: submatches[4],
+			Pods:        pods,
+			Nodes:       nodes,
+			Cores:       cores,
+			NodeVersion: submatches[4],
 		}, nil
 	}
 	return nil, fmt.Errorf("Unable to parse line, clusterInfo: %s did not match expr: %s", string(input), clusterInfoExpr)
@@ -69,22 +100,130 @@ func GetClusterInfo(pods []v1.Pod, nodes []v1.Node) *ClusterInfo {
 	}
 
 	return &ClusterInfo{
-		pods:        numPods,
-		nodes:       len(nodes),
-		cores:       int(millicores / 1000.0),
-		nodeVersion: version,
+		Pods:        numPods,
+		Nodes:       len(nodes),
+		Cores:       int(millicores / 1000.0),
+		NodeVersion: version,
 	}
 }
 
 func (c *ClusterInfo) String() string {
-	return fmt.Sprintf(clusterInfoTemplate, c.pods, c.nodes, c.cores, c.nodeVersion)
+	return fmt.Sprintf(clusterInfoTemplate, c.Pods, c.Nodes, c.Cores, c.NodeVersion)
+}
+
+// ToRecord returns the cluster info as a record line, for use as scraper output.
+func (c *ClusterInfo) ToRecord() (string, error) {
+	return common.NewRecord(common.ClusterInfoRecordKind, c)
 }
 
 func (c *ClusterInfo) ToSlice() []string {
-	return []string{strconv.Itoa(c.pods), strconv.Itoa(c.nodes), strconv.Itoa(c.cores), c.nodeVersion}
+	return []string{strconv.Itoa(c.Pods), strconv.Itoa(c.Nodes), strconv.Itoa(c.Cores), c.NodeVersion}
+}
+
+// GetClusterEvents returns the cluster info and the events of a cluster with
+// one of the reasons, computed from its snapshot if it has one, or parsed from
+// the scraper output otherwise.
+func GetClusterEvents(output common.ClusterOutput, reasons Reasons) (*ClusterEvents, error) {
+	if output.Snapshot != nil {
+		events := output.Snapshot.Events
+		info := GetClusterInfo(output.Snapshot.Pods, output.Snapshot.Nodes)
+		return newClusterEvents(info, events, reasons, Window{}.Cover(events, latestTime(events))), nil
+	}
+	return ParseClusterEvents(output.Lines, reasons)
+}
+
+// ParseClusterEvents parses the events scraper output for a single cluster,
+// keeping the events with one of the reasons.  If the output contains records,
+// only the records are used.  Otherwise, the output is parsed using the legacy
+// format.
+func ParseClusterEvents(lines []string, reasons Reasons) (*ClusterEvents, error) {
+	var clusterInfo *ClusterInfo
+	var window *Window
+	eventList := []v1.Event{}
+	foundRecord := false
+	for _, line := range lines {
+		if !common.IsRecord(line) {
+			continue
+		}
+		foundRecord = true
+		record, err := common.ParseRecord(line)
+		if err != nil {
+			return nil, err
+		}
+		switch record.Kind {
+		case common.ClusterInfoRecordKind:
+			clusterInfo = &ClusterInfo{}
+			if err := record.Decode(clusterInfo); err != nil {
+				return nil, err
+			}
+		case common.EventRecordKind:
+			event := v1.Event{}
+			if err := record.Decode(&event); err != nil {
+				return nil, err
+			}
+			eventList = append(eventList, event)
+		case common.EventWindowRecordKind:
+			window = &Window{}
+			if err := record.Decode(window); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if foundRecord {
+		if clusterInfo == nil {
+			return nil, ErrMissingClusterInfo
+		}
+		if window == nil {
+			// scraped before windows were recorded
+			covered := Window{}.Cover(eventList, latestTime(eventList))
+			window = &covered
+		}
+		return newClusterEvents(clusterInfo, eventList, reasons, *window), nil
+	}
+	return parseLegacyClusterEvents(lines, reasons)
+}
+
+// newClusterEvents returns the cluster events for the events of a cluster
+// with one of the reasons.
+func newClusterEvents(info *ClusterInfo, events []v1.Event, reasons Reasons, window Window) *ClusterEvents {
+	events = reasons.Filter(events)
+	return &ClusterEvents{
+		Info:      info,
+		Reasons:   reasons,
+		Events:    AggregateEvents(events),
+		Breakdown: GetBreakdown(events),
+		Evictions: GetEvictionStats(events),
+		OOMs:      GetOOMStats(events),
+		Window:    window,
+	}
+}
+
+func parseLegacyClusterEvents(lines []string, reasons Reasons) (*ClusterEvents, error) {
+	/*
+		Lines are as follows, ignoring trailing empty lines:
+		0: "starting shell script"
+		1: "Getting Events"
+		2...n-3: Events
+		n-2: "Getting ClusterInfo"
+		n-1: ClusterInfo
+	*/
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) < 4 {
+		return nil, fmt.Errorf("Unable to parse cluster events, expected at least 4 lines, got %d", len(lines))
+	}
+	clusterInfo, err := ParseClusterInfo(lines[len(lines)-1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMissingClusterInfo, err)
+	}
+	// the legacy format has no timestamps, so the window is unknown
+	return newClusterEvents(clusterInfo, parseEventList(strings.Join(lines[2:len(lines)-2], "")), reasons, Window{}), nil
 }
 
-func ParseDisruptiveEventList(input string) DisruptiveEventList {
+// parseEventList parses the events in the legacy format, without aggregating
+// them.
+func parseEventList(input string) []v1.Event {
 	events := strings.Split(input, ";")
 	eventList := []v1.Event{}
 	for _, eventString := range events {
@@ -93,13 +232,11 @@ func ParseDisruptiveEventList(input string) DisruptiveEventList {
 			eventList = append(eventList, *event)
 		}
 	}
-	return AggregateEvents(eventList)
+	return eventList
 }
 
 func ParseEvent(input string) (*v1.Event, error) {
-	re := regexp.MustCompile(eventExpr)
-	if re.MatchString(input) {
-		submatches := re.FindStringSubmatch(input)
+	if submatches := eventRegexp.FindStringSubmatch(input); submatches != nil {
 		count, err := strconv.ParseInt(submatches[3], 10, 32)
 		if err != nil {
 			return nil, err
@@ -117,7 +254,7 @@ func AggregateEvents(inputEvents []v1.Event) []v1.Event {
 	outputEvents := []v1.Event{}
 	eventMap := make(map[string]int32)
 	for _, event := range inputEvents {
-		eventMap[event.Reason] += event.Count
+		eventMap[event.Reason] += eventCount(event)
 	}
 	for k, v := range eventMap {
 		outputEvents = append(outputEvents, v1.Event{
@@ -125,23 +262,13 @@ func AggregateEvents(inputEvents []v1.Event) []v1.Event {
 			Count:  v,
 		})
 	}
+	sort.Slice(outputEvents, func(i, j int) bool {
+		return outputEvents[i].Reason < outputEvents[j].Reason
+	})
 	return outputEvents
 }
 
-func GetDisruptiveEventList(events []v1.Event) DisruptiveEventList {
-	disruptiveReasons := []string{"Evicted", "OOMKilling", "SystemOOM"}
-	filteredEvents := []v1.Event{}
-	for _, event := range events {
-		for _, reason := range disruptiveReasons {
-			if event.Reason == reason {
-				filteredEvents = append(filteredEvents, event)
-			}
-		}
-	}
-	return filteredEvents
-}
-
-func (d DisruptiveEventList) String() string {
+func (d EventList) String() string {
 	eventString := ""
 	for _, event := range d {
 		eventString += fmt.Sprintf(eventTemplate, event.Reason, event.Message, event.Count)
@@ -150,10 +277,69 @@ func (d DisruptiveEventList) String() string {
 	return strings.TrimSuffix(eventString, ";")
 }
 
-func (d DisruptiveEventList) ToSlice() []string {
-	eventSlice := []string{}
+// ToRecords returns one record line per event, for use as scraper output.
+// Only the fields used when processing events are kept.
+func (d EventList) ToRecords() ([]string, error) {
+	records := []string{}
 	for _, event := range d {
-		eventSlice = append(eventSlice, event.Reason, strconv.FormatInt(int64(event.Count), 10))
+		record, err := common.NewRecord(common.EventRecordKind, v1.Event{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: event.Namespace,
+			},
+			InvolvedObject: event.InvolvedObject,
+			Reason:         event.Reason,
+			Message:        event.Message,
+			Source:         event.Source,
+			FirstTimestamp: event.FirstTimestamp,
+			LastTimestamp:  event.LastTimestamp,
+			EventTime:      event.EventTime,
+			Series:         event.Series,
+			Count:          event.Count,
+		})
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// GetClusterEventsHeader returns the header of the columns returned by
+// ToSlice, for the given reasons.
+func GetClusterEventsHeader(reasons Reasons) []string {
+	header := []string{"Pods", "Nodes", "Cores", "Node Version", "Days"}
+	header = append(header, reasons...)
+	for _, reason := range reasons {
+		header = append(header, reason+" Per Day")
+	}
+	return append(header, "Container OOMs", "System OOMs")
+}
+
+// Count returns the number of events with the reason.
+func (c *ClusterEvents) Count(reason string) int32 {
+	for _, event := range c.Events {
+		if event.Reason == reason {
+			return event.Count
+		}
+	}
+	return 0
+}
+
+// ToSlice returns the cluster info, the length of the window in days, the
+// count of each reason, and the events per day of each reason, in the order
+// of the reasons, followed by the number of container and system OOM kills.
+// The days and events per day are empty if the window is unknown.
+func (c *ClusterEvents) ToSlice() []string {
+	days := c.Window.Days()
+	slice := c.Info.ToSlice()
+	slice = append(slice, formatDays(days))
+	for _, reason := range c.Reasons {
+		slice = append(slice, strconv.FormatInt(int64(c.Count(reason)), 10))
+	}
+	for _, reason := range c.Reasons {
+		slice = append(slice, perDay(c.Count(reason), days))
 	}
-	return eventSlice
+	return append(slice,
+		strconv.FormatInt(int64(c.OOMs.Total(ContainerOOMKind)), 10),
+		strconv.FormatInt(int64(c.OOMs.Total(SystemOOMKind)), 10))
 }
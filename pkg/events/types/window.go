@@ -0,0 +1,191 @@
+package types
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"k8s.io/api/core/v1"
+
+	"github.com/dashpole/allocatable/pkg/common"
+)
+
+const day = 24 * time.Hour
+
+// Window is a period of time.  A zero Since or Until leaves that end of the
+// window unbounded.
+type Window struct {
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"`
+}
+
+// ParseWindow returns the window between since and until, which are either
+// durations before now, e.g. 24h, or RFC3339 times.  Empty values are
+// unbounded.
+func ParseWindow(since, until string, now time.Time) (Window, error) {
+	w := Window{}
+	var err error
+	if w.Since, err = parseTime(since, now); err != nil {
+		return w, fmt.Errorf("Unable to parse since: %v", err)
+	}
+	if w.Until, err = parseTime(until, now); err != nil {
+		return w, fmt.Errorf("Unable to parse until: %v", err)
+	}
+	if !w.Since.IsZero() && !w.Until.IsZero() && w.Until.Before(w.Since) {
+		return w, fmt.Errorf("Until %v is before since %v", w.Until, w.Since)
+	}
+	return w, nil
+}
+
+func parseTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// Filter returns the events which occurred in the window.  An event which
+// repeated both inside and outside the window is kept with its count
+// pro-rated by the overlap, as the times of the individual occurrences are
+// unknown.  Events without any timestamp are only kept if the window is
+// unbounded.
+func (w Window) Filter(events []v1.Event) []v1.Event {
+	if w.Since.IsZero() && w.Until.IsZero() {
+		return events
+	}
+	filtered := []v1.Event{}
+	for _, event := range events {
+		first, last := eventTimes(event)
+		if first.IsZero() {
+			continue
+		}
+		if !w.Since.IsZero() && last.Before(w.Since) {
+			continue
+		}
+		if !w.Until.IsZero() && first.After(w.Until) {
+			continue
+		}
+		filtered = append(filtered, w.prorate(event, first, last))
+	}
+	return filtered
+}
+
+// prorate returns the event with its count scaled by the fraction of the time
+// between its first and last occurrence which is in the window, assuming the
+// occurrences are evenly spread.  At least one occurrence is kept.
+func (w Window) prorate(event v1.Event, first, last time.Time) v1.Event {
+	start, end := first, last
+	if !w.Since.IsZero() && start.Before(w.Since) {
+		start = w.Since
+	}
+	if !w.Until.IsZero() && end.After(w.Until) {
+		end = w.Until
+	}
+	if start.Equal(first) && end.Equal(last) {
+		return event
+	}
+	count := int32(math.Round(float64(eventCount(event)) * float64(end.Sub(start)) / float64(last.Sub(first))))
+	if count < 1 {
+		count = 1
+	}
+	event.Count = count
+	return event
+}
+
+// Cover returns the period the window covers for a cluster with the given
+// events.  As the API server deletes events after a TTL, it starts at the
+// oldest event if that is after Since.  It ends at Until, or at now if Until
+// is unbounded or in the future.
+func (w Window) Cover(events []v1.Event, now time.Time) Window {
+	covered := Window{Since: w.Since, Until: w.Until}
+	if covered.Until.IsZero() || covered.Until.After(now) {
+		covered.Until = now
+	}
+	oldest := time.Time{}
+	for _, event := range events {
+		if first, _ := eventTimes(event); !first.IsZero() && (oldest.IsZero() || first.Before(oldest)) {
+			oldest = first
+		}
+	}
+	if oldest.After(covered.Since) {
+		covered.Since = oldest
+	}
+	return covered
+}
+
+// Days returns the length of the window in days, or zero if it is unbounded.
+func (w Window) Days() float64 {
+	if w.Since.IsZero() || w.Until.IsZero() || !w.Until.After(w.Since) {
+		return 0
+	}
+	return float64(w.Until.Sub(w.Since)) / float64(day)
+}
+
+// ToRecord returns the window as a record line, for use as scraper output.
+func (w Window) ToRecord() (string, error) {
+	return common.NewRecord(common.EventWindowRecordKind, w)
+}
+
+// eventTimes returns the first and last time an event occurred, from its
+// FirstTimestamp and LastTimestamp, or its EventTime and Series for events
+// created with the events.k8s.io API.  Both are zero if the event has no
+// timestamps.
+func eventTimes(event v1.Event) (first, last time.Time) {
+	first = event.FirstTimestamp.Time
+	if first.IsZero() {
+		first = event.EventTime.Time
+	}
+	last = event.LastTimestamp.Time
+	if last.IsZero() && event.Series != nil {
+		last = event.Series.LastObservedTime.Time
+	}
+	if last.IsZero() {
+		last = first
+	}
+	if first.IsZero() {
+		first = last
+	}
+	return first, last
+}
+
+// latestTime returns the last time any of the events occurred.
+func latestTime(events []v1.Event) time.Time {
+	latest := time.Time{}
+	for _, event := range events {
+		if _, last := eventTimes(event); last.After(latest) {
+			latest = last
+		}
+	}
+	return latest
+}
+
+// eventCount returns the number of times an event occurred.
+func eventCount(event v1.Event) int32 {
+	if event.Count > 0 {
+		return event.Count
+	}
+	if event.Series != nil && event.Series.Count > 0 {
+		return event.Series.Count
+	}
+	return 1
+}
+
+func formatDays(days float64) string {
+	if days == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(days, 'f', 2, 64)
+}
+
+// perDay returns count per day over days, formatted for output, or an empty
+// string if days is zero.
+func perDay(count int32, days float64) string {
+	if days == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(float64(count)/days, 'f', 2, 64)
+}
@@ -0,0 +1,235 @@
+package types
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var now = time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+
+// timedEvent returns an event which occurred count times between first and
+// last.
+func timedEvent(reason string, first, last time.Time, count int32) v1.Event {
+	return v1.Event{Reason: reason, FirstTimestamp: metav1.NewTime(first), LastTimestamp: metav1.NewTime(last), Count: count}
+}
+
+func TestParseWindow(t *testing.T) {
+	testCases := []struct {
+		name      string
+		since     string
+		until     string
+		want      Window
+		wantError bool
+	}{
+		{name: "unbounded", want: Window{}},
+		{name: "duration", since: "48h", want: Window{Since: now.Add(-48 * time.Hour)}},
+		{
+			name:  "duration and time",
+			since: "72h",
+			until: "2024-01-09T00:00:00Z",
+			want:  Window{Since: now.Add(-72 * time.Hour), Until: now.Add(-24 * time.Hour)},
+		},
+		{name: "only until", until: "1h", want: Window{Until: now.Add(-time.Hour)}},
+		{name: "until before since", since: "1h", until: "2h", wantError: true},
+		{name: "invalid since", since: "yesterday", wantError: true},
+		{name: "invalid until", until: "2024-01-09", wantError: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseWindow(tc.since, tc.until, now)
+			if tc.wantError {
+				if err == nil {
+					t.Fatalf("ParseWindow() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseWindow() returned error: %v", err)
+			}
+			if !got.Since.Equal(tc.want.Since) || !got.Until.Equal(tc.want.Until) {
+				t.Errorf("ParseWindow() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFilter(t *testing.T) {
+	window := Window{Since: now.Add(-48 * time.Hour), Until: now.Add(-24 * time.Hour)}
+	testCases := []struct {
+		name      string
+		window    Window
+		event     v1.Event
+		wantKept  bool
+		wantCount int32
+	}{
+		{
+			name:      "inside",
+			window:    window,
+			event:     timedEvent("Evicted", now.Add(-40*time.Hour), now.Add(-30*time.Hour), 5),
+			wantKept:  true,
+			wantCount: 5,
+		},
+		{
+			name:   "before",
+			window: window,
+			event:  timedEvent("Evicted", now.Add(-72*time.Hour), now.Add(-60*time.Hour), 5),
+		},
+		{
+			name:   "after",
+			window: window,
+			event:  timedEvent("Evicted", now.Add(-time.Hour), now.Add(-time.Hour), 1),
+		},
+		{
+			name:      "overlaps the start",
+			window:    window,
+			event:     timedEvent("Evicted", now.Add(-58*time.Hour), now.Add(-38*time.Hour), 10),
+			wantKept:  true,
+			wantCount: 5,
+		},
+		{
+			name:      "overlaps the end",
+			window:    window,
+			event:     timedEvent("Evicted", now.Add(-27*time.Hour), now.Add(-23*time.Hour), 8),
+			wantKept:  true,
+			wantCount: 6,
+		},
+		{
+			name:      "spans the window",
+			window:    window,
+			event:     timedEvent("Evicted", now.Add(-96*time.Hour), now, 96),
+			wantKept:  true,
+			wantCount: 24,
+		},
+		{
+			name:      "barely overlaps",
+			window:    window,
+			event:     timedEvent("Evicted", now.Add(-148*time.Hour), now.Add(-48*time.Hour), 3),
+			wantKept:  true,
+			wantCount: 1,
+		},
+		{
+			name:   "series",
+			window: window,
+			event: v1.Event{
+				Reason:    "SystemOOM",
+				EventTime: metav1.NewMicroTime(now.Add(-50 * time.Hour)),
+				Series:    &v1.EventSeries{Count: 4, LastObservedTime: metav1.NewMicroTime(now.Add(-46 * time.Hour))},
+			},
+			wantKept:  true,
+			wantCount: 2,
+		},
+		{
+			name:   "no timestamps",
+			window: window,
+			event:  v1.Event{Reason: "Evicted", Count: 1},
+		},
+		{
+			name:      "no timestamps in an unbounded window",
+			event:     v1.Event{Reason: "Evicted", Count: 1},
+			wantKept:  true,
+			wantCount: 1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			filtered := tc.window.Filter([]v1.Event{tc.event})
+			if !tc.wantKept {
+				if len(filtered) != 0 {
+					t.Errorf("Filter() kept %+v, want it dropped", filtered)
+				}
+				return
+			}
+			if len(filtered) != 1 {
+				t.Fatalf("Filter() dropped the event, want it kept")
+			}
+			if got := eventCount(filtered[0]); got != tc.wantCount {
+				t.Errorf("got count %d, want %d", got, tc.wantCount)
+			}
+		})
+	}
+}
+
+func TestCover(t *testing.T) {
+	events := []v1.Event{
+		timedEvent("Evicted", now.Add(-72*time.Hour), now.Add(-60*time.Hour), 5),
+		timedEvent("OOMKilling", now.Add(-30*time.Hour), now.Add(-30*time.Hour), 1),
+		{Reason: "Evicted"},
+	}
+	testCases := []struct {
+		name     string
+		window   Window
+		events   []v1.Event
+		want     Window
+		wantDays float64
+	}{
+		{
+			name:     "unbounded starts at the oldest event",
+			events:   events,
+			want:     Window{Since: now.Add(-72 * time.Hour), Until: now},
+			wantDays: 3,
+		},
+		{
+			name:     "since before the oldest event",
+			window:   Window{Since: now.Add(-96 * time.Hour)},
+			events:   events,
+			want:     Window{Since: now.Add(-72 * time.Hour), Until: now},
+			wantDays: 3,
+		},
+		{
+			name:     "since after the oldest event",
+			window:   Window{Since: now.Add(-48 * time.Hour), Until: now.Add(-24 * time.Hour)},
+			events:   events,
+			want:     Window{Since: now.Add(-48 * time.Hour), Until: now.Add(-24 * time.Hour)},
+			wantDays: 1,
+		},
+		{
+			name:     "until in the future",
+			window:   Window{Since: now.Add(-12 * time.Hour), Until: now.Add(time.Hour)},
+			events:   events,
+			want:     Window{Since: now.Add(-12 * time.Hour), Until: now},
+			wantDays: 0.5,
+		},
+		{
+			name:     "no events",
+			want:     Window{Until: now},
+			wantDays: 0,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.window.Cover(tc.events, now)
+			if !got.Since.Equal(tc.want.Since) || !got.Until.Equal(tc.want.Until) {
+				t.Errorf("Cover() = %+v, want %+v", got, tc.want)
+			}
+			if days := got.Days(); days != tc.wantDays {
+				t.Errorf("Days() = %v, want %v", days, tc.wantDays)
+			}
+		})
+	}
+}
+
+func TestDays(t *testing.T) {
+	testCases := []struct {
+		name   string
+		window Window
+		want   float64
+	}{
+		{name: "unbounded", window: Window{}, want: 0},
+		{name: "no since", window: Window{Until: now}, want: 0},
+		{name: "no until", window: Window{Since: now}, want: 0},
+		{name: "empty", window: Window{Since: now, Until: now}, want: 0},
+		{name: "reversed", window: Window{Since: now, Until: now.Add(-day)}, want: 0},
+		{name: "hours", window: Window{Since: now.Add(-6 * time.Hour), Until: now}, want: 0.25},
+		{name: "week", window: Window{Since: now.Add(-7 * day), Until: now}, want: 7},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.window.Days(); got != tc.want {
+				t.Errorf("Days() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	allocatable "github.com/dashpole/allocatable/pkg/allocatable/analysis"
+	"github.com/dashpole/allocatable/pkg/common"
+	events "github.com/dashpole/allocatable/pkg/events/analysis"
+	"github.com/dashpole/allocatable/pkg/events/types"
+)
+
+var path = flag.String("path", "", "path to a directory of kubectl dumps (nodes.json, pods.json and events.json), a directory of such directories, or a tarball of them")
+var nodesFile = flag.String("nodes", "", "path to the output of kubectl get nodes -o json; used instead of --path to analyze a single cluster")
+var podsFile = flag.String("pods", "", "path to the output of kubectl get pods --all-namespaces -o json; used with --nodes")
+var eventsFile = flag.String("events", "", "path to the output of kubectl get events --all-namespaces -o json; used with --nodes")
+var outputDir = flag.String("output-dir", "_output/offline", "directory to write the results to")
+var policiesFile = flag.String("policies", "", "path to a YAML or JSON file of reservation policies to compare; if empty, the default policy is used")
+var summaryGroupBy = flag.String("summary-group-by", "", "if set, group the fleet summary by project, location or version")
+var reasons = flag.String("reasons", types.DefaultProfile, "comma separated list of the event reasons to analyze, or of the profiles disruptive, scheduling, node-health and crashes")
+var maxFailureRate = flag.Float64("max-failure-rate", common.DefaultMaxFailureRate, "exit with a non-zero status if more than this fraction of clusters could not be analyzed")
+var parallelism = flag.Int("parallelism", 0, "number of clusters to analyze at once; if 0, one per CPU")
+
+func main() {
+	flag.Parse()
+	eventReasons, err := types.ParseReasons(*reasons)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(common.FatalExitCode)
+	}
+	source, err := getSource()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening input: %v\n", err)
+		os.Exit(common.FatalExitCode)
+	}
+	allDiagnostics, err := analyze(source, *outputDir, eventReasons)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(common.FatalExitCode)
+	}
+	for _, diagnostics := range allDiagnostics {
+		if diagnostics.ExceedsFailureRate(*maxFailureRate) {
+			fmt.Fprintf(os.Stderr, "Unable to analyze %d of %d clusters, which exceeds the maximum failure rate of %v\n", diagnostics.FailedClusters, diagnostics.Clusters, *maxFailureRate)
+			os.Exit(common.FailureRateExitCode)
+		}
+	}
+}
+
+// analyze runs the allocatable and events analysis of the clusters in source,
+// writes the results to dir, and returns the diagnostics of both.  The
+// snapshots are only read and decoded once, and shared by both analyses.
+func analyze(source common.Source, dir string, eventReasons types.Reasons) ([]*common.Diagnostics, error) {
+	source = common.NewCachedSource(source)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("Error creating output directory: %v", err)
+	}
+	fmt.Println("Analyzing Allocatable")
+	allocatableDiagnostics, err := allocatable.Run(source, allocatable.Options{
+		Output:           filepath.Join(dir, "specificClusterStats.csv"),
+		PoliciesFile:     *policiesFile,
+		NodeReport:       filepath.Join(dir, "nodeReport.csv"),
+		NodeReportFormat: "csv",
+		Summary:          filepath.Join(dir, "fleetSummary"),
+		SummaryGroupBy:   *summaryGroupBy,
+		Parallelism:      *parallelism,
+		Diagnostics:      filepath.Join(dir, "diagnostics.json"),
+		StatusReport:     filepath.Join(dir, "clusterStatus.csv"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("Analyzing Events")
+	eventDiagnostics, err := events.Run(source, events.Options{
+		Output:      filepath.Join(dir, "eventStats.csv"),
+		Reasons:     eventReasons,
+		Parallelism: *parallelism,
+		Diagnostics: filepath.Join(dir, "eventDiagnostics.json"),
+		Breakdown:   filepath.Join(dir, "eventBreakdown.csv"),
+		Evictions:   filepath.Join(dir, "evictionStats.csv"),
+		OOMs:        filepath.Join(dir, "oomStats.csv"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []*common.Diagnostics{allocatableDiagnostics, eventDiagnostics}, nil
+}
+
+// getSource returns the source selected by the flags.
+func getSource() (common.Source, error) {
+	if *nodesFile != "" {
+		return common.NewSnapshotSource(*nodesFile, *podsFile, *eventsFile), nil
+	}
+	if *path == "" {
+		return nil, fmt.Errorf("Either --path or --nodes must be set")
+	}
+	info, err := os.Stat(*path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return common.NewSource(common.KubectlSource, *path)
+	}
+	return common.NewSource(common.TarballSource, *path)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/dashpole/allocatable/pkg/common"
+	"github.com/dashpole/allocatable/pkg/events/types"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata/golden")
+
+// TestAnalyzeGolden analyzes the kubectl dumps in testdata/snapshots, and
+// compares every output file with the one of the same name in
+// testdata/golden.  Run with -update to regenerate them.
+func TestAnalyzeGolden(t *testing.T) {
+	source, err := common.NewSource(common.KubectlSource, filepath.Join("testdata", "snapshots"))
+	if err != nil {
+		t.Fatalf("NewSource() returned error: %v", err)
+	}
+	eventReasons, err := types.ParseReasons("disruptive,scheduling")
+	if err != nil {
+		t.Fatalf("ParseReasons() returned error: %v", err)
+	}
+	dir := t.TempDir()
+	allDiagnostics, err := analyze(source, dir, eventReasons)
+	if err != nil {
+		t.Fatalf("analyze() returned error: %v", err)
+	}
+	for _, diagnostics := range allDiagnostics {
+		if diagnostics.Clusters != 3 || diagnostics.FailedClusters != 1 {
+			t.Errorf("got %d failed of %d clusters, want 1 of 3", diagnostics.FailedClusters, diagnostics.Clusters)
+		}
+	}
+
+	golden := filepath.Join("testdata", "golden")
+	got := readDir(t, dir)
+	if *update {
+		if err := os.RemoveAll(golden); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(golden, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for name, contents := range got {
+			if err := os.WriteFile(filepath.Join(golden, name), []byte(contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return
+	}
+	want := readDir(t, golden)
+	for _, name := range sortedNames(want) {
+		if _, ok := got[name]; !ok {
+			t.Errorf("%s was not written", name)
+		} else if got[name] != want[name] {
+			t.Errorf("%s differs from the golden file:\ngot:\n%s\nwant:\n%s", name, got[name], want[name])
+		}
+	}
+	for _, name := range sortedNames(got) {
+		if _, ok := want[name]; !ok {
+			t.Errorf("%s has no golden file", name)
+		}
+	}
+}
+
+// readDir returns the contents of each file in dir by name.
+func readDir(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, entry := range entries {
+		contents, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[entry.Name()] = string(contents)
+	}
+	return files
+}
+
+func sortedNames(files map[string]string) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -37,7 +37,8 @@ if ! sudo curl https://storage.googleapis.com/allocatable/$BINARY > $BINARY; the
 fi
 
 # execute binary
-if ! ./$BINARY; then
+# errors are printed to stderr, and are part of the output
+if ! ./$BINARY 2>&1; then
 	echo "failed ./$BINARY"
 	cleanup
 fi